@@ -0,0 +1,57 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/MaxFedotov/orcus-exporter/config"
+)
+
+// authRoundTripper adds credentials and static headers to every request.
+type authRoundTripper struct {
+	auth config.Auth
+	next http.RoundTripper
+}
+
+// NewAuthRoundTripper creates a RoundTripper which adds credentials and headers from auth
+// to every request and sends it using next.
+func NewAuthRoundTripper(auth config.Auth, next http.RoundTripper) http.RoundTripper {
+	return &authRoundTripper{
+		auth: auth,
+		next: next,
+	}
+}
+
+// RoundTrip sends a copy of the request with credentials and headers added.
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper must not modify the request, so headers are set on a copy
+	r := req.WithContext(req.Context())
+	r.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		r.Header[name] = append([]string(nil), values...)
+	}
+
+	for name, value := range rt.auth.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			r.Host = value
+			continue
+		}
+		r.Header.Set(name, value)
+	}
+	if rt.auth.Username != "" {
+		r.SetBasicAuth(rt.auth.Username, rt.auth.Password)
+	}
+	if rt.auth.BearerToken != "" {
+		r.Header.Set("Authorization", "Bearer "+rt.auth.BearerToken)
+	}
+	return rt.next.RoundTrip(r)
+}
+
+// CloseIdleConnections closes idle connections of the underlying RoundTripper.
+func (rt *authRoundTripper) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if next, ok := rt.next.(closeIdler); ok {
+		next.CloseIdleConnections()
+	}
+}
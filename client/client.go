@@ -1,24 +1,16 @@
 package client
 
 import (
-	"log"
-	"time"
+	"context"
+	"fmt"
+	"net/http"
 )
 
-// CreateClientWithRetries tries to create a client for service and retries in case of error
-func CreateClientWithRetries(service string, getClient func() (interface{}, error), retries uint, retryInterval time.Duration) (interface{}, error) {
-	var err error
-	var client interface{}
-
-	for i := 0; i <= int(retries); i++ {
-		client, err = getClient()
-		if err == nil {
-			return client, nil
-		}
-		if i < int(retries) {
-			log.Printf("Could not create %s Client. Retrying in %v...", service, retryInterval)
-			time.Sleep(retryInterval)
-		}
+// newRequest creates a GET request for url which is cancelled when ctx is done.
+func newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %v: %v", url, err)
 	}
-	return nil, err
+	return req.WithContext(ctx), nil
 }
@@ -0,0 +1,362 @@
+package client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MaxFedotov/orcus-exporter/config"
+	"github.com/go-sql-driver/mysql"
+	ini "gopkg.in/ini.v1"
+)
+
+// maxMycnfIncludeDepth limits nesting of !include and !includedir directives, MySQL has the same limit
+const maxMycnfIncludeDepth = 10
+
+// SSL modes of MySQL clients
+const (
+	sslModeDisabled       = "DISABLED"
+	sslModePreferred      = "PREFERRED"
+	sslModeRequired       = "REQUIRED"
+	sslModeVerifyCA       = "VERIFY_CA"
+	sslModeVerifyIdentity = "VERIFY_IDENTITY"
+)
+
+// mycnfOptions represents where MySQL credentials are read from and how connections are made.
+type mycnfOptions struct {
+	myCnf string
+	// section is read in addition to [client], its options take precedence
+	section string
+	// loginPath is a section of the login path file, its options take precedence over my.cnf
+	loginPath string
+	tlsName   string
+	tls       config.TLS
+	timeout   time.Duration
+}
+
+// parseMycnf builds DSN from credentials in my.cnf and the login path file. Custom TLS configuration
+// is registered under opts.tlsName, so collectors with different TLS settings do not overwrite each other's.
+func parseMycnf(opts mycnfOptions) (string, error) {
+	content, err := readMycnf(opts.myCnf, 0)
+	if err != nil {
+		return "", err
+	}
+	options, err := loadMycnfOptions(content, "client", opts.section)
+	if err != nil {
+		return "", fmt.Errorf("failed reading ini file: %s", err)
+	}
+	if opts.section != "" && !options.sections[opts.section] {
+		return "", fmt.Errorf("no [%s] section in %s", opts.section, opts.myCnf)
+	}
+	if opts.loginPath != "" {
+		loginFile := myloginCnfPath()
+		content, err := readMyloginCnf(loginFile)
+		if err != nil {
+			return "", fmt.Errorf("failed reading login path file %s: %s", loginFile, err)
+		}
+		login, err := loadMycnfOptions(content, opts.loginPath)
+		if err != nil {
+			return "", fmt.Errorf("failed reading login path file %s: %s", loginFile, err)
+		}
+		if !login.sections[opts.loginPath] {
+			return "", fmt.Errorf("no login path %s in %s", opts.loginPath, loginFile)
+		}
+		for key, value := range login.values {
+			options.values[key] = value
+		}
+	}
+
+	// User defaults to the operating system user, so auth_socket logins need neither user nor password
+	cfg := mysql.NewConfig()
+	cfg.User = options.values["user"]
+	if cfg.User == "" {
+		current, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("no user specified and failed to get current user: %s", err)
+		}
+		cfg.User = current.Username
+	}
+	cfg.Passwd = options.values["password"]
+	host := options.values["host"]
+	if host == "" {
+		host = "localhost"
+	}
+	port := options.values["port"]
+	if port == "" {
+		port = "3306"
+	}
+	// Like MySQL clients, socket is used only for connections to localhost
+	if socket := options.values["socket"]; socket != "" && host == "localhost" {
+		cfg.Net = "unix"
+		cfg.Addr = socket
+	} else {
+		cfg.Net = "tcp"
+		cfg.Addr = host + ":" + port
+	}
+	cfg.Timeout = opts.timeout
+	cfg.ReadTimeout = opts.timeout
+	cfg.WriteTimeout = opts.timeout
+
+	// TLS files from exporter configuration take precedence over ones from my.cnf
+	sslMode := strings.ToUpper(options.values["ssl-mode"])
+	sslCA := options.values["ssl-ca"]
+	sslCert := options.values["ssl-cert"]
+	sslKey := options.values["ssl-key"]
+	if opts.tls.CAFile != "" {
+		sslCA, sslCert, sslKey = opts.tls.CAFile, opts.tls.CertFile, opts.tls.KeyFile
+	}
+	switch {
+	case sslMode == sslModeDisabled:
+	case sslMode == sslModePreferred && sslCA == "" && sslCert == "":
+		// The driver can not fall back to unencrypted connection, so TLS is used only if files are set,
+		// otherwise servers without TLS would become unreachable with the default mode of MySQL clients
+	case sslMode != "" || sslCA != "":
+		if tlsErr := customizeTLS(opts.tlsName, sslMode, sslCA, sslCert, sslKey, opts.tls.SSLVerify); tlsErr != nil {
+			tlsErr = fmt.Errorf("failed to register a custom TLS configuration for mysql dsn: %s", tlsErr)
+			return "", tlsErr
+		}
+		cfg.TLSConfig = opts.tlsName
+	}
+
+	return cfg.FormatDSN(), nil
+}
+
+// mycnfOptionValues represents options read from my.cnf sections.
+type mycnfOptionValues struct {
+	values map[string]string
+	// sections are names of sections found in the file
+	sections map[string]bool
+}
+
+// loadMycnfOptions reads options from sections of content. Options of later sections take precedence.
+// Dashes and underscores in option names are equivalent, so names are normalized to dashes.
+func loadMycnfOptions(content []byte, sections ...string) (*mycnfOptionValues, error) {
+	opts := ini.LoadOptions{
+		// MySQL ini file can have boolean keys.
+		AllowBooleanKeys: true,
+	}
+	cfg, err := ini.LoadSources(opts, content)
+	if err != nil {
+		return nil, err
+	}
+	options := &mycnfOptionValues{
+		values:   make(map[string]string),
+		sections: make(map[string]bool),
+	}
+	for _, name := range sections {
+		if name == "" {
+			continue
+		}
+		section, err := cfg.GetSection(name)
+		if err != nil {
+			continue
+		}
+		options.sections[name] = true
+		for _, key := range section.Keys() {
+			options.values[strings.Replace(key.Name(), "_", "-", -1)] = key.String()
+		}
+	}
+	return options, nil
+}
+
+// readMycnf reads filename with files included by !include and !includedir directives.
+// Relative paths of included files are resolved against the directory of filename.
+func readMycnf(filename string, depth int) ([]byte, error) {
+	if depth > maxMycnfIncludeDepth {
+		return nil, fmt.Errorf("too deep nesting of included files in %s", filename)
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading ini file: %s", err)
+	}
+
+	var buf bytes.Buffer
+	var section string
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		var included []string
+		switch {
+		case strings.HasPrefix(trimmed, "!includedir"):
+			dir := includePath(filename, strings.TrimPrefix(trimmed, "!includedir"))
+			// MySQL reads files of the directory in no particular order, they are sorted for repeatable results
+			if included, err = filepath.Glob(filepath.Join(dir, "*.cnf")); err != nil {
+				return nil, err
+			}
+			sort.Strings(included)
+		case strings.HasPrefix(trimmed, "!include"):
+			included = []string{includePath(filename, strings.TrimPrefix(trimmed, "!include"))}
+		default:
+			if strings.HasPrefix(trimmed, "[") {
+				section = trimmed
+			}
+			buf.WriteString(line)
+			buf.WriteString("\n")
+			continue
+		}
+		for _, file := range included {
+			content, err := readMycnf(file, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(content)
+			buf.WriteString("\n")
+		}
+		// Options following the directive belong to the section of the including file
+		if section != "" {
+			buf.WriteString(section)
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// includePath returns path of a file included by filename.
+func includePath(filename string, path string) string {
+	path = strings.TrimSpace(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(filename), path)
+}
+
+// myloginCnfPath returns path of the login path file maintained by mysql_config_editor.
+func myloginCnfPath() string {
+	if path := os.Getenv("MYSQL_TEST_LOGIN_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(os.Getenv("HOME"), ".mylogin.cnf")
+}
+
+// readMyloginCnf decrypts the login path file. The file starts with 4 unused bytes and 20 bytes
+// of AES key, followed by lines of the ini file encrypted with AES-128-ECB, each prefixed with its length.
+func readMyloginCnf(filename string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 {
+		return nil, fmt.Errorf("file is too short")
+	}
+	var key [16]byte
+	for i, b := range data[4:24] {
+		key[i%len(key)] ^= b
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for rest := data[24:]; len(rest) > 0; {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("truncated line length")
+		}
+		length := int(binary.LittleEndian.Uint32(rest))
+		rest = rest[4:]
+		if length == 0 || length > len(rest) || length%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid line length %d", length)
+		}
+		line := make([]byte, length)
+		for i := 0; i < length; i += aes.BlockSize {
+			block.Decrypt(line[i:i+aes.BlockSize], rest[i:i+aes.BlockSize])
+		}
+		// Lines are padded with PKCS#7
+		padding := int(line[length-1])
+		if padding == 0 || padding > aes.BlockSize {
+			return nil, fmt.Errorf("invalid padding of encrypted line")
+		}
+		buf.Write(line[:length-padding])
+		rest = rest[length:]
+	}
+	return buf.Bytes(), nil
+}
+
+// customizeTLS registers TLS configuration for sslMode under name.
+func customizeTLS(name string, sslMode string, sslCA string, sslCert string, sslKey string, sslVerify bool) error {
+	tlsCfg, err := newTLSConfig(sslMode, sslCA, sslCert, sslKey, sslVerify)
+	if err != nil {
+		return err
+	}
+	return mysql.RegisterTLSConfig(name, tlsCfg)
+}
+
+// newTLSConfig creates TLS configuration for sslMode. If sslMode is empty, server certificate
+// is verified against sslCA unless client certificate is set and sslVerify is false.
+func newTLSConfig(sslMode string, sslCA string, sslCert string, sslKey string, sslVerify bool) (*tls.Config, error) {
+	var tlsCfg tls.Config
+	if sslCA != "" {
+		caBundle := x509.NewCertPool()
+		pemCA, err := ioutil.ReadFile(sslCA)
+		if err != nil {
+			return nil, err
+		}
+		if ok := caBundle.AppendCertsFromPEM(pemCA); ok {
+			tlsCfg.RootCAs = caBundle
+		} else {
+			return nil, fmt.Errorf("failed parse pem-encoded CA certificates from %s", sslCA)
+		}
+	}
+	if sslCert != "" && sslKey != "" {
+		certPairs := make([]tls.Certificate, 0, 1)
+		keypair, err := tls.LoadX509KeyPair(sslCert, sslKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pem-encoded SSL cert %s or SSL key %s: %s",
+				sslCert, sslKey, err)
+		}
+		certPairs = append(certPairs, keypair)
+		tlsCfg.Certificates = certPairs
+		if sslMode == "" {
+			tlsCfg.InsecureSkipVerify = !sslVerify
+		}
+	}
+
+	switch sslMode {
+	case "", sslModeVerifyIdentity:
+	case sslModePreferred, sslModeRequired:
+		tlsCfg.InsecureSkipVerify = true
+	case sslModeVerifyCA:
+		if tlsCfg.RootCAs == nil {
+			return nil, fmt.Errorf("ssl-ca must be set for ssl-mode %s", sslMode)
+		}
+		// Certificate chain is verified without host name
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, tlsCfg.RootCAs)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ssl-mode %s", sslMode)
+	}
+	return &tlsCfg, nil
+}
+
+// verifyCertificateChain verifies certificates sent by server against roots.
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server sent no certificates")
+	}
+	intermediates := x509.NewCertPool()
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func writeFile(t *testing.T, filename string, content []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mycnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// writeCA writes a self-signed CA certificate to filename.
+func writeCA(t *testing.T, filename string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// encryptMyloginCnf encrypts content the way mysql_config_editor does.
+func encryptMyloginCnf(t *testing.T, content string) []byte {
+	t.Helper()
+	rawKey := []byte("0123456789abcdefghij")
+	var key [16]byte
+	for i, b := range rawKey {
+		key[i%len(key)] ^= b
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.Write([]byte{0, 0, 0, 0})
+	buf.Write(rawKey)
+	for _, line := range bytes.SplitAfter([]byte(content), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		padding := aes.BlockSize - len(line)%aes.BlockSize
+		line = append(line, bytes.Repeat([]byte{byte(padding)}, padding)...)
+		encrypted := make([]byte, len(line))
+		for i := 0; i < len(line); i += aes.BlockSize {
+			block.Encrypt(encrypted[i:i+aes.BlockSize], line[i:i+aes.BlockSize])
+		}
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(len(encrypted)))
+		buf.Write(length[:])
+		buf.Write(encrypted)
+	}
+	return buf.Bytes()
+}
+
+func TestParseMycnfSSLMode(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	ca := filepath.Join(dir, "ca.pem")
+	writeCA(t, ca)
+
+	tests := []struct {
+		name string
+		mode string
+		ca   bool
+		tls  bool
+		skip bool
+		err  bool
+	}{
+		{name: "unset"},
+		{name: "unset with CA", ca: true, tls: true},
+		{name: "disabled", mode: "DISABLED", ca: true},
+		{name: "preferred", mode: "PREFERRED"},
+		{name: "preferred with CA", mode: "preferred", ca: true, tls: true, skip: true},
+		{name: "required", mode: "REQUIRED", tls: true, skip: true},
+		{name: "verify CA", mode: "VERIFY_CA", ca: true, tls: true, skip: true},
+		{name: "verify CA without CA", mode: "VERIFY_CA", err: true},
+		{name: "verify identity", mode: "VERIFY_IDENTITY", ca: true, tls: true},
+		{name: "unknown", mode: "ALWAYS", err: true},
+	}
+	for _, test := range tests {
+		options := "[client]\nuser=exporter\npassword=secret\nhost=db\n"
+		if test.mode != "" {
+			options += "ssl_mode=" + test.mode + "\n"
+		}
+		sslCA := ""
+		if test.ca {
+			sslCA = ca
+			options += "ssl-ca=" + ca + "\n"
+		}
+		myCnf := filepath.Join(dir, "my.cnf")
+		writeFile(t, myCnf, []byte(options))
+		dsn, err := parseMycnf(mycnfOptions{myCnf: myCnf, tlsName: "test_ssl_mode", timeout: time.Second})
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got DSN %s", test.name, dsn)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			t.Errorf("%s: DSN %s can not be parsed: %v", test.name, dsn, err)
+			continue
+		}
+		if tls := cfg.TLSConfig != ""; tls != test.tls {
+			t.Errorf("%s: expected TLS %v, got DSN %s", test.name, test.tls, dsn)
+			continue
+		}
+		if !test.tls {
+			continue
+		}
+		tlsCfg, err := newTLSConfig(strings.ToUpper(test.mode), sslCA, "", "", false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if tlsCfg.InsecureSkipVerify != test.skip {
+			t.Errorf("%s: expected InsecureSkipVerify %v, got %v", test.name, test.skip, tlsCfg.InsecureSkipVerify)
+		}
+	}
+}
+
+func TestReadMycnfIncludes(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	myCnf := filepath.Join(dir, "my.cnf")
+	writeFile(t, myCnf, []byte(`[client]
+user=base
+password=base
+!includedir conf.d
+host=db1
+
+[client_orcus_exporter]
+user=exporter
+!include extra.cnf
+`))
+	writeFile(t, filepath.Join(dir, "conf.d", "a.cnf"), []byte("[mysql]\nuser=mysql\n[client]\nport=3307\n"))
+	writeFile(t, filepath.Join(dir, "conf.d", "b.cnf"), []byte("[client]\nport=3308\n"))
+	writeFile(t, filepath.Join(dir, "conf.d", "ignored.txt"), []byte("[client]\nport=3309\n"))
+	writeFile(t, filepath.Join(dir, "extra.cnf"), []byte("[client_orcus_exporter]\npassword=extra\n"))
+	writeFile(t, filepath.Join(dir, "loop.cnf"), []byte("[client]\n!include loop.cnf\n"))
+
+	tests := []struct {
+		name    string
+		myCnf   string
+		section string
+		dsn     string
+		err     bool
+	}{
+		// Options following !includedir stay in [client], files of conf.d are read in sorted order
+		{name: "client", myCnf: myCnf, dsn: "base:base@tcp(db1:3308)/"},
+		// Options of the section override [client]
+		{name: "section", myCnf: myCnf, section: "client_orcus_exporter", dsn: "exporter:extra@tcp(db1:3308)/"},
+		{name: "missing section", myCnf: myCnf, section: "client_missing", err: true},
+		{name: "include loop", myCnf: filepath.Join(dir, "loop.cnf"), err: true},
+		{name: "missing file", myCnf: filepath.Join(dir, "missing.cnf"), err: true},
+	}
+	for _, test := range tests {
+		dsn, err := parseMycnf(mycnfOptions{myCnf: test.myCnf, section: test.section})
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got DSN %s", test.name, dsn)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if dsn != test.dsn {
+			t.Errorf("%s: expected DSN %s, got %s", test.name, test.dsn, dsn)
+		}
+	}
+}
+
+func TestParseMycnfLoginPath(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	myCnf := filepath.Join(dir, "my.cnf")
+	writeFile(t, myCnf, []byte("[client]\nuser=base\npassword=base\nhost=db1\n"))
+	loginFile := filepath.Join(dir, "mylogin.cnf")
+	writeFile(t, loginFile, encryptMyloginCnf(t, `[client]
+user = "client"
+[orcus_exporter]
+user = "exporter"
+password = "p@ss:word"
+host = "localhost"
+socket = "/var/run/mysqld/mysqld.sock"
+`))
+	defer os.Setenv("MYSQL_TEST_LOGIN_FILE", os.Getenv("MYSQL_TEST_LOGIN_FILE"))
+	os.Setenv("MYSQL_TEST_LOGIN_FILE", loginFile)
+
+	content, err := readMyloginCnf(loginFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(content, []byte(`password = "p@ss:word"`)) {
+		t.Errorf("unexpected decrypted content: %s", content)
+	}
+
+	dsn, err := parseMycnf(mycnfOptions{myCnf: myCnf, loginPath: "orcus_exporter"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "exporter:p@ss:word@unix(/var/run/mysqld/mysqld.sock)/"; dsn != expected {
+		t.Errorf("expected DSN %s, got %s", expected, dsn)
+	}
+	if _, err := parseMycnf(mycnfOptions{myCnf: myCnf, loginPath: "missing"}); err == nil {
+		t.Errorf("expected error for missing login path")
+	}
+
+	writeFile(t, loginFile, encryptMyloginCnf(t, "[client]\n")[:30])
+	if _, err := readMyloginCnf(loginFile); err == nil {
+		t.Errorf("expected error for truncated file")
+	}
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -12,23 +13,36 @@ type Oauth2ProxyClient struct {
 	httpClient  *http.Client
 }
 
-// NewOauth2ProxyClient creates an Oauth2ProxyClient.
-func NewOauth2ProxyClient(httpClient *http.Client, apiEndpoint string) (*Oauth2ProxyClient, error) {
+// NewOauth2ProxyClient creates an Oauth2ProxyClient. Status of oauth2_proxy is checked within ctx.
+func NewOauth2ProxyClient(ctx context.Context, httpClient *http.Client, apiEndpoint string) (*Oauth2ProxyClient, error) {
 	client := &Oauth2ProxyClient{
 		apiEndpoint: apiEndpoint,
 		httpClient:  httpClient,
 	}
 
-	if err := client.GetStatus(); err != nil {
+	if err := client.GetStatus(ctx); err != nil {
 		return nil, fmt.Errorf("Failed to create oauth2_proxy: %v", err)
 	}
 
 	return client, nil
 }
 
-// GetStatus fetches the oauth2_proxy metrics.
-func (client *Oauth2ProxyClient) GetStatus() error {
-	resp, err := client.httpClient.Get(client.apiEndpoint)
+// NewOauth2ProxyProbeClient creates an Oauth2ProxyClient for a single probe of apiEndpoint.
+// Availability of oauth2_proxy is not checked, it is reported by the scrape.
+func NewOauth2ProxyProbeClient(httpClient *http.Client, apiEndpoint string) *Oauth2ProxyClient {
+	return &Oauth2ProxyClient{
+		apiEndpoint: apiEndpoint,
+		httpClient:  httpClient,
+	}
+}
+
+// GetStatus fetches the oauth2_proxy metrics within ctx.
+func (client *Oauth2ProxyClient) GetStatus(ctx context.Context) error {
+	req, err := newRequest(ctx, client.apiEndpoint)
+	if err != nil {
+		return err
+	}
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to get %v: %v", client.apiEndpoint, err)
 	}
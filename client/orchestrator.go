@@ -1,182 +1,317 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sync"
 )
 
 // OrchestratorClient allows you to get Orchestrator metrics.
 type OrchestratorClient struct {
 	apiEndpoint string
 	httpClient  *http.Client
+	recoveries  *recoveryTracker
+	// endpoints are API endpoints of all known Orchestrator nodes
+	endpoints     []string
+	discoverNodes bool
+	mutex         sync.Mutex
 }
 
-// OrchestratorFailovers represents failover metrics
-type OrchestratorFailovers struct {
-	ID int64
+// OrchestratorInstanceKey represents MySQL instance identity
+type OrchestratorInstanceKey struct {
+	Hostname string
+	Port     int
 }
 
-// OrchestratorFailedSeed represents failed seeds
-type OrchestratorFailedSeed struct {
-	SeedID int64
+// OrchestratorNullInt64 represents nullable integer value
+type OrchestratorNullInt64 struct {
+	Int64 int64
+	Valid bool
+}
+
+// OrchestratorInstance represents MySQL instance as seen by Orchestrator
+type OrchestratorInstance struct {
+	Key                        OrchestratorInstanceKey
+	ClusterName                string
+	ReadOnly                   bool
+	ReplicationSQLThreadRuning bool
+	ReplicationIOThreadRuning  bool
+	SecondsBehindMaster        OrchestratorNullInt64
+	ReplicationLagSeconds      OrchestratorNullInt64
+	IsLastCheckValid           bool
+	IsRecentlyChecked          bool
+	IsDowntimed                bool
+	DowntimeOwner              string
+	DowntimeReason             string
+	DowntimeEndTimestamp       string
+	MasterKey                  OrchestratorInstanceKey
+	Problems                   []string
+}
+
+// ProblemTypes returns types of problems detected by Orchestrator for the instance.
+// Orchestrator versions which do not report problem types get them derived from instance state.
+func (instance OrchestratorInstance) ProblemTypes() []string {
+	if len(instance.Problems) > 0 {
+		return instance.Problems
+	}
+	var problems []string
+	if instance.IsDowntimed {
+		problems = append(problems, "downtimed")
+	}
+	if !instance.IsLastCheckValid {
+		problems = append(problems, "last_check_invalid")
+	} else if !instance.IsRecentlyChecked {
+		problems = append(problems, "not_recently_checked")
+	}
+	if instance.MasterKey.Hostname != "" && !(instance.ReplicationSQLThreadRuning && instance.ReplicationIOThreadRuning) {
+		problems = append(problems, "not_replicating")
+	} else if instance.ReplicationLagSeconds.Valid && instance.ReplicationLagSeconds.Int64 > 0 {
+		problems = append(problems, "replication_lag")
+	}
+	if len(problems) == 0 {
+		problems = append(problems, "unknown")
+	}
+	return problems
+}
+
+// OrchestratorClusterInfo represents MySQL cluster summary
+type OrchestratorClusterInfo struct {
+	ClusterName                            string
+	ClusterAlias                           string
+	CountInstances                         uint
+	HeuristicLag                           int64
+	HasAutomatedMasterRecovery             bool
+	HasAutomatedIntermediateMasterRecovery bool
 }
 
 // OrchestratorMetrics represents Orchestrator metrics.
 type OrchestratorMetrics struct {
-	Status         HealthStatus
-	Problems       []interface{}
+	// Status is health status of the configured node, it is nil if the node is unreachable while
+	// other nodes serve the rest of metrics
+	Status         *HealthStatus
+	Problems       []OrchestratorInstance
 	LastFailoverID int64
-	FailedSeeds    int
+	Recoveries     OrchestratorRecoveries
+	// GlobalRecoveries is true if recoveries are not disabled globally, it is nil if the check failed
+	GlobalRecoveries  *bool
+	BlockedRecoveries []OrchestratorBlockedRecovery
+	// ClusterRecoveries maps MySQL clusters to state of their recoveries
+	ClusterRecoveries map[string]OrchestratorClusterRecoveries
+	FailedSeeds       []OrchestratorSeed
+	Agents            *OrchestratorAgents
+	Raft              *OrchestratorRaft
+	Downtimes         []OrchestratorDowntime
+	Maintenance       []OrchestratorMaintenance
+	Clusters          []OrchestratorClusterInfo
+	Instances         []OrchestratorInstance
+	Nodes             []OrchestratorNode
+	// Errors are errors of optional metrics, which are skipped without failing the scrape.
+	// Agents and Raft are nil if their metrics could not be fetched.
+	Errors []error
 }
 
 // HealthStatus represents status related metrics.
 type HealthStatus struct {
 	Details struct {
-		Healthy        bool
-		IsActiveNode   bool
-		AvailableNodes []interface{}
+		Hostname           string
+		Token              string
+		Healthy            bool
+		IsActiveNode       bool
+		AvailableNodes     []OrchestratorNodeHealth
+		RaftLeader         string
+		IsRaftLeader       bool
+		RaftAdvertise      string
+		RaftHealthyMembers []string
 	}
 }
 
-// NewOrchestratorClient creates an OrchestratorClient.
-func NewOrchestratorClient(httpClient *http.Client, apiEndpoint string) (*OrchestratorClient, error) {
-	client := &OrchestratorClient{
-		apiEndpoint: apiEndpoint,
-		httpClient:  httpClient,
+// unexpectedStatusError is returned when Orchestrator API responds with non-OK status
+type unexpectedStatusError struct {
+	statusCode int
+}
+
+func (err *unexpectedStatusError) Error() string {
+	return fmt.Sprintf("expected %v response, got %v", http.StatusOK, err.statusCode)
+}
+
+// NewOrchestratorClient creates an OrchestratorClient. Health of apiEndpoint and additional nodes is checked
+// on every scrape, the rest of metrics are fetched from the active node. If discoverNodes is true,
+// nodes reported as available by Orchestrator are checked as well. Metrics are fetched within ctx
+// to check Orchestrator is available.
+func NewOrchestratorClient(ctx context.Context, httpClient *http.Client, apiEndpoint string, nodes []string, discoverNodes bool) (*OrchestratorClient, error) {
+	client := newOrchestratorClient(httpClient, apiEndpoint)
+	client.discoverNodes = discoverNodes
+	for _, node := range nodes {
+		if !client.isKnownEndpoint(node) {
+			client.endpoints = append(client.endpoints, node)
+		}
 	}
 
-	if _, err := client.GetMetrics(); err != nil {
+	if _, err := client.GetMetrics(ctx); err != nil {
 		return nil, fmt.Errorf("Failed to create Orchestrator client: %v", err)
 	}
 
 	return client, nil
 }
 
-// GetMetrics fetches Orchestrator metrics.
-func (client *OrchestratorClient) GetMetrics() (*OrchestratorMetrics, error) {
-	var metrics OrchestratorMetrics
-	var err error
-	metrics.Status, err = client.getStatus()
+// NewOrchestratorProbeClient creates an OrchestratorClient for a single probe of apiEndpoint.
+// Availability of Orchestrator is not checked, it is reported by the scrape.
+func NewOrchestratorProbeClient(httpClient *http.Client, apiEndpoint string) *OrchestratorClient {
+	return newOrchestratorClient(httpClient, apiEndpoint)
+}
+
+func newOrchestratorClient(httpClient *http.Client, apiEndpoint string) *OrchestratorClient {
+	return &OrchestratorClient{
+		apiEndpoint: apiEndpoint,
+		httpClient:  httpClient,
+		recoveries:  newRecoveryTracker(),
+		endpoints:   []string{apiEndpoint},
+	}
+}
+
+// GetMetrics fetches Orchestrator metrics within ctx.
+func (client *OrchestratorClient) GetMetrics(ctx context.Context) (*OrchestratorMetrics, error) {
+	nodes, statuses, err := client.getNodes(ctx)
 	if err != nil {
 		return nil, err
 	}
-	metrics.Problems, err = client.getProblems("/problems")
+	endpoint := activeEndpoint(nodes)
+	nodeClient := &OrchestratorClient{
+		apiEndpoint: endpoint,
+		httpClient:  client.httpClient,
+		recoveries:  client.recoveries,
+	}
+	metrics, err := nodeClient.getMetrics(ctx, statuses[endpoint])
 	if err != nil {
 		return nil, err
 	}
-	metrics.LastFailoverID, err = client.getFailovers("/audit-recovery")
+	// Health of the configured node is reported even if the rest of metrics come from another node
+	if status, ok := statuses[client.apiEndpoint]; ok {
+		metrics.Status = &status
+	} else {
+		metrics.addError("status", fmt.Errorf("node %s is unreachable", client.apiEndpoint))
+	}
+	metrics.Nodes = nodes
+	return metrics, nil
+}
+
+// getMetrics fetches metrics of the node with the given health status. Only problems, recoveries
+// and failed seeds are required, errors of the rest of metrics are stored in Errors.
+func (client *OrchestratorClient) getMetrics(ctx context.Context, status HealthStatus) (*OrchestratorMetrics, error) {
+	var metrics OrchestratorMetrics
+	var err error
+	metrics.Problems, err = client.getProblems(ctx, "/problems")
 	if err != nil {
 		return nil, err
 	}
-	metrics.FailedSeeds, err = client.getFailedSeeds("/agents-failed-seeds")
+	metrics.Recoveries, err = client.getRecoveries(ctx, "/audit-recovery")
 	if err != nil {
 		return nil, err
 	}
-	return &metrics, nil
-
-}
-
-func (client *OrchestratorClient) getFailedSeeds(endpoint string) (int, error) {
-	url := client.apiEndpoint + endpoint
-	resp, err := client.httpClient.Get(url)
-	failedSeeds := []OrchestratorFailedSeed{}
+	metrics.LastFailoverID = metrics.Recoveries.LastID
+	metrics.FailedSeeds, err = client.getFailedSeeds(ctx, "/agents-failed-seeds")
 	if err != nil {
-		return 0, fmt.Errorf("failed to get %v: %v", url, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("expected %v response, got %v", http.StatusOK, resp.StatusCode)
+	if raft, err := client.getRaft(ctx, status); err != nil {
+		metrics.addError("raft", err)
+	} else {
+		metrics.Raft = &raft
 	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read the response body: %v", err)
+	if agents, err := client.getAgents(ctx); err != nil {
+		metrics.addError("agents", err)
+	} else {
+		metrics.Agents = &agents
 	}
-
-	err = json.Unmarshal(body, &failedSeeds)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse response body %q: %v", string(body), err)
+	if enabled, err := client.getGlobalRecoveries(ctx, "/check-global-recoveries"); err != nil {
+		metrics.addError("global recoveries", err)
+	} else {
+		metrics.GlobalRecoveries = &enabled
 	}
-	return len(failedSeeds), nil
-}
-
-func (client *OrchestratorClient) getFailovers(endpoint string) (lastFailoverID int64, err error) {
-	url := client.apiEndpoint + endpoint
-	resp, err := client.httpClient.Get(url)
-	failovers := []OrchestratorFailovers{}
-	if err != nil {
-		return 0, fmt.Errorf("failed to get %v: %v", url, err)
+	if metrics.BlockedRecoveries, err = client.getBlockedRecoveries(ctx, "/blocked-recoveries"); err != nil {
+		metrics.addError("blocked recoveries", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("expected %v response, got %v", http.StatusOK, resp.StatusCode)
+	if metrics.Downtimes, err = client.getDowntimes(ctx, "/downtimed"); err != nil {
+		metrics.addError("downtimes", err)
 	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read the response body: %v", err)
+	if metrics.Maintenance, err = client.getMaintenance(ctx, "/maintenance"); err != nil {
+		metrics.addError("maintenance", err)
 	}
-
-	err = json.Unmarshal(body, &failovers)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse response body %q: %v", string(body), err)
+	if metrics.Clusters, err = client.getClustersInfo(ctx, "/clusters-info"); err != nil {
+		metrics.addError("clusters", err)
 	}
-	for _, failover := range failovers {
-		if failover.ID > lastFailoverID {
-			lastFailoverID = failover.ID
+	metrics.ClusterRecoveries = make(map[string]OrchestratorClusterRecoveries, len(metrics.Clusters))
+	for _, cluster := range metrics.Clusters {
+		instances, err := client.getClusterInstances(ctx, "/cluster/"+url.PathEscape(cluster.ClusterName))
+		if err != nil {
+			metrics.addError("instances of cluster "+cluster.ClusterName, err)
+		}
+		metrics.Instances = append(metrics.Instances, instances...)
+		recoveries, err := client.getClusterRecoveries(ctx, cluster.ClusterName)
+		if err != nil {
+			metrics.addError("recoveries of cluster "+cluster.ClusterName, err)
+			continue
 		}
+		metrics.ClusterRecoveries[cluster.ClusterName] = recoveries
 	}
-	return lastFailoverID, nil
+	return &metrics, nil
 }
 
-func (client *OrchestratorClient) getProblems(endpoint string) (metric []interface{}, err error) {
-	url := client.apiEndpoint + endpoint
-	resp, err := client.httpClient.Get(url)
-	if err != nil {
-		return metric, fmt.Errorf("failed to get %v: %v", url, err)
-	}
-	defer resp.Body.Close()
+// addError stores err of optional metrics.
+func (metrics *OrchestratorMetrics) addError(name string, err error) {
+	metrics.Errors = append(metrics.Errors, fmt.Errorf("failed to get %s metrics: %v", name, err))
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return metric, fmt.Errorf("expected %v response, got %v", http.StatusOK, resp.StatusCode)
-	}
+func (client *OrchestratorClient) getProblems(ctx context.Context, endpoint string) (metric []OrchestratorInstance, err error) {
+	err = client.get(ctx, endpoint, &metric)
+	return metric, err
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return metric, fmt.Errorf("failed to read the response body: %v", err)
-	}
+func (client *OrchestratorClient) getClustersInfo(ctx context.Context, endpoint string) (metric []OrchestratorClusterInfo, err error) {
+	err = client.get(ctx, endpoint, &metric)
+	return metric, err
+}
 
-	err = json.Unmarshal(body, &metric)
-	if err != nil {
-		return metric, fmt.Errorf("failed to parse response body %q: %v", string(body), err)
-	}
-	return metric, nil
+func (client *OrchestratorClient) getStatus(ctx context.Context) (metric HealthStatus, err error) {
+	err = client.get(ctx, "/status", &metric)
+	return metric, err
 }
 
-func (client *OrchestratorClient) getStatus() (metric HealthStatus, err error) {
-	url := client.apiEndpoint + "/status"
-	resp, err := client.httpClient.Get(url)
+func (client *OrchestratorClient) getClusterInstances(ctx context.Context, endpoint string) (metric []OrchestratorInstance, err error) {
+	err = client.get(ctx, endpoint, &metric)
+	return metric, err
+}
+
+// get fetches Orchestrator API endpoint and decodes JSON response into v.
+func (client *OrchestratorClient) get(ctx context.Context, endpoint string, v interface{}) error {
+	uri := client.apiEndpoint + endpoint
+	req, err := newRequest(ctx, uri)
+	if err != nil {
+		return err
+	}
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
-		return metric, fmt.Errorf("failed to get %v: %v", url, err)
+		return fmt.Errorf("failed to get %v: %v", uri, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return metric, fmt.Errorf("expected %v response, got %v", http.StatusOK, resp.StatusCode)
+		return &unexpectedStatusError{statusCode: resp.StatusCode}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return metric, fmt.Errorf("failed to read the response body: %v", err)
+		return fmt.Errorf("failed to read the response body: %v", err)
 	}
 
-	err = json.Unmarshal(body, &metric)
+	err = json.Unmarshal(body, v)
 	if err != nil {
-		return metric, fmt.Errorf("failed to parse response body %q: %v", string(body), err)
+		return fmt.Errorf("failed to parse response body %q: %v", string(body), err)
 	}
-	return metric, nil
+	return nil
 }
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// OrchestratorAgent represents orchestrator-agent registered in Orchestrator
+type OrchestratorAgent struct {
+	Hostname      string
+	Port          int
+	LastSubmitted string
+	LastSeen      time.Time `json:"-"`
+}
+
+// OrchestratorSeed represents seed operation performed by orchestrator-agents
+type OrchestratorSeed struct {
+	SeedID         int64 `json:"SeedId"`
+	TargetHostname string
+	SourceHostname string
+	StartTimestamp string
+	IsComplete     bool
+	IsSuccessful   bool
+}
+
+// OrchestratorSeedState represents a stage of seed operation
+type OrchestratorSeedState struct {
+	SeedStateID    int64 `json:"SeedStateId"`
+	SeedID         int64 `json:"SeedId"`
+	StateTimestamp string
+	Action         string
+	ErrorMessage   string
+}
+
+// OrchestratorActiveSeed represents seed operation in progress
+type OrchestratorActiveSeed struct {
+	OrchestratorSeed
+	Start time.Time
+	// Stage is the action of the most recent seed state
+	Stage string
+	// Stages is a number of stages seed operation has passed
+	Stages int
+}
+
+// OrchestratorAgents represents orchestrator-agents metrics
+type OrchestratorAgents struct {
+	Agents      []OrchestratorAgent
+	ActiveSeeds []OrchestratorActiveSeed
+}
+
+// getAgents fetches orchestrator-agents and their seeds in progress. LastSeen of agents and Start of seeds
+// with unparsable timestamps are left zero.
+func (client *OrchestratorClient) getAgents(ctx context.Context) (metric OrchestratorAgents, err error) {
+	if err = client.get(ctx, "/agents", &metric.Agents); err != nil {
+		return metric, err
+	}
+	for i, agent := range metric.Agents {
+		metric.Agents[i].LastSeen, _ = parseOrchestratorTimestamp(agent.LastSubmitted)
+	}
+
+	var activeSeeds []OrchestratorSeed
+	if err = client.get(ctx, "/agents-active-seeds", &activeSeeds); err != nil {
+		return metric, err
+	}
+	for _, seed := range activeSeeds {
+		activeSeed := OrchestratorActiveSeed{OrchestratorSeed: seed}
+		activeSeed.Start, _ = parseOrchestratorTimestamp(seed.StartTimestamp)
+		var states []OrchestratorSeedState
+		if err = client.get(ctx, "/agent-seed-states/"+strconv.FormatInt(seed.SeedID, 10), &states); err != nil {
+			return metric, err
+		}
+		// Seed states are returned in descending order of time
+		activeSeed.Stages = len(states)
+		if len(states) > 0 {
+			activeSeed.Stage = states[0].Action
+		}
+		metric.ActiveSeeds = append(metric.ActiveSeeds, activeSeed)
+	}
+	return metric, nil
+}
+
+func (client *OrchestratorClient) getFailedSeeds(ctx context.Context, endpoint string) (metric []OrchestratorSeed, err error) {
+	err = client.get(ctx, endpoint, &metric)
+	return metric, err
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MaxFedotov/orcus-exporter/config"
+	"github.com/go-sql-driver/mysql"
+)
+
+// orchestratorAuditTables are backend tables which grow with history of Orchestrator operations
+var orchestratorAuditTables = []string{
+	"audit",
+	"database_instance_analysis_changelog",
+	"node_health_history",
+	"topology_failure_detection",
+	"topology_recovery",
+	"topology_recovery_steps",
+}
+
+// OrchestratorBackendClient allows you to get metrics of Orchestrator backend database.
+type OrchestratorBackendClient struct {
+	dsn          string
+	pollInterval time.Duration
+	db           *sql.DB
+	mutex        sync.Mutex
+	// closed is set by Close, connection is not opened after that
+	closed bool
+}
+
+// OrchestratorBackendMetrics represents Orchestrator backend database metrics.
+type OrchestratorBackendMetrics struct {
+	Instances int
+	// LastCheckedAge and LastSeenAge are seconds elapsed since the most recent check of any instance,
+	// they are invalid if there are no instances
+	LastCheckedAge sql.NullInt64
+	LastSeenAge    sql.NullInt64
+	// NotRecentlyChecked is a number of instances not checked within poll interval
+	NotRecentlyChecked int
+	// NodeHealth maps Orchestrator nodes to seconds elapsed since they were seen active last time
+	NodeHealth  map[string]int64
+	AuditTables []OrchestratorBackendTable
+}
+
+// OrchestratorBackendTable represents size of backend table
+type OrchestratorBackendTable struct {
+	Name string
+	// Rows is an estimated number of rows
+	Rows uint64
+	Size uint64
+}
+
+// OrchestratorBackendDSN builds DSN of Orchestrator backend database from my.cnf and cfg.
+func OrchestratorBackendDSN(cfg config.OrchestratorBackendCollector) (string, error) {
+	dsn, err := parseMycnf(mycnfOptions{
+		myCnf:     cfg.MyCnf,
+		section:   cfg.MyCnfSection,
+		loginPath: cfg.LoginPath,
+		tlsName:   "orchestrator_backend",
+		tls:       cfg.TLS,
+		timeout:   cfg.Timeout,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse my.cnf for Orchestrator backend client: %v", err)
+	}
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse my.cnf for Orchestrator backend client: %v", err)
+	}
+	mysqlCfg.DBName = cfg.Database
+	return mysqlCfg.FormatDSN(), nil
+}
+
+// NewOrchestratorBackendClient creates an OrchestratorBackendClient for dsn built by OrchestratorBackendDSN.
+// Metrics are fetched within ctx to check the database is available.
+func NewOrchestratorBackendClient(ctx context.Context, dsn string, cfg config.OrchestratorBackendCollector) (*OrchestratorBackendClient, error) {
+	client := &OrchestratorBackendClient{
+		dsn:          dsn,
+		pollInterval: cfg.PollInterval,
+	}
+
+	if _, err := client.GetMetrics(ctx); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Failed to create Orchestrator backend client: %v", err)
+	}
+
+	return client, nil
+}
+
+// GetMetrics fetches Orchestrator backend database metrics within ctx.
+func (client *OrchestratorBackendClient) GetMetrics(ctx context.Context) (*OrchestratorBackendMetrics, error) {
+	db, err := client.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics OrchestratorBackendMetrics
+	// Ages are calculated by the database, because timestamps are stored in its time zone
+	query := fmt.Sprintf(`SELECT COUNT(*),
+		TIMESTAMPDIFF(SECOND, MAX(last_checked), NOW()),
+		TIMESTAMPDIFF(SECOND, MAX(last_seen), NOW()),
+		COALESCE(SUM(last_checked < NOW() - INTERVAL %d SECOND), 0)
+		FROM database_instance`, int64(client.pollInterval.Seconds()))
+	err = db.QueryRowContext(ctx, query).Scan(&metrics.Instances, &metrics.LastCheckedAge,
+		&metrics.LastSeenAge, &metrics.NotRecentlyChecked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
+	}
+
+	metrics.NodeHealth, err = getNodeHealth(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
+	}
+	metrics.AuditTables, err = getAuditTables(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
+	}
+	return &metrics, nil
+}
+
+// connect returns a database handle which is checked to be alive within ctx.
+// If the check fails, the handle is closed and a new one is opened on the next call.
+func (client *OrchestratorBackendClient) connect(ctx context.Context) (*sql.DB, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return nil, errors.New("client is closed")
+	}
+	if client.db == nil {
+		db, err := sql.Open("mysql", client.dsn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open connection to database: %v", err)
+		}
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(1 * time.Minute)
+		client.db = db
+	}
+	if err := client.db.PingContext(ctx); err != nil {
+		client.db.Close()
+		client.db = nil
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return client.db, nil
+}
+
+// Close closes connection to the database, calls of GetMetrics after that fail.
+func (client *OrchestratorBackendClient) Close() error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.closed = true
+	if client.db == nil {
+		return nil
+	}
+	err := client.db.Close()
+	client.db = nil
+	return err
+}
+
+// getNodeHealth returns seconds elapsed since every Orchestrator node was seen active last time.
+func getNodeHealth(ctx context.Context, db *sql.DB) (map[string]int64, error) {
+	// Node has a row for every start, the most recent one is used
+	rows, err := db.QueryContext(ctx, `SELECT hostname, TIMESTAMPDIFF(SECOND, MAX(last_seen_active), NOW())
+		FROM node_health GROUP BY hostname`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodeHealth := make(map[string]int64)
+	for rows.Next() {
+		var hostname string
+		var age int64
+		if err := rows.Scan(&hostname, &age); err != nil {
+			return nil, err
+		}
+		nodeHealth[hostname] = age
+	}
+	return nodeHealth, rows.Err()
+}
+
+// getAuditTables returns sizes of audit tables from table statistics.
+func getAuditTables(ctx context.Context, db *sql.DB) ([]OrchestratorBackendTable, error) {
+	query := fmt.Sprintf(`SELECT table_name, COALESCE(table_rows, 0), COALESCE(data_length + index_length, 0)
+		FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name IN ('%s')`,
+		strings.Join(orchestratorAuditTables, "', '"))
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []OrchestratorBackendTable
+	for rows.Next() {
+		var table OrchestratorBackendTable
+		if err := rows.Scan(&table.Name, &table.Rows, &table.Size); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
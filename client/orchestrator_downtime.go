@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// OrchestratorDowntime represents downtime of MySQL instance
+type OrchestratorDowntime struct {
+	Key         OrchestratorInstanceKey
+	ClusterName string
+	Owner       string
+	Reason      string
+	End         time.Time
+}
+
+// OrchestratorMaintenance represents active maintenance of MySQL instance
+type OrchestratorMaintenance struct {
+	MaintenanceID  int64 `json:"MaintenanceId"`
+	Key            OrchestratorInstanceKey
+	BeginTimestamp string
+	SecondsElapsed int64
+	IsActive       bool
+	Owner          string
+	Reason         string
+}
+
+// getDowntimes fetches downtimes of MySQL instances. Downtimes with unparsable end time are skipped.
+func (client *OrchestratorClient) getDowntimes(ctx context.Context, endpoint string) ([]OrchestratorDowntime, error) {
+	instances := []OrchestratorInstance{}
+	if err := client.get(ctx, endpoint, &instances); err != nil {
+		return nil, err
+	}
+	downtimes := make([]OrchestratorDowntime, 0, len(instances))
+	for _, instance := range instances {
+		end, err := parseOrchestratorTimestamp(instance.DowntimeEndTimestamp)
+		if err != nil {
+			continue
+		}
+		downtimes = append(downtimes, OrchestratorDowntime{
+			Key:         instance.Key,
+			ClusterName: instance.ClusterName,
+			Owner:       instance.DowntimeOwner,
+			Reason:      instance.DowntimeReason,
+			End:         end,
+		})
+	}
+	return downtimes, nil
+}
+
+func (client *OrchestratorClient) getMaintenance(ctx context.Context, endpoint string) (metric []OrchestratorMaintenance, err error) {
+	err = client.get(ctx, endpoint, &metric)
+	return metric, err
+}
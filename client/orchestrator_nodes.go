@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/url"
+)
+
+// OrchestratorNodeHealth represents Orchestrator node reported in health status
+type OrchestratorNodeHealth struct {
+	Hostname       string
+	AppVersion     string
+	LastSeenActive string
+}
+
+// OrchestratorNode represents health of Orchestrator node
+type OrchestratorNode struct {
+	// Node is host and port of the node API endpoint
+	Node         string
+	Endpoint     string
+	Up           bool
+	Healthy      bool
+	IsActiveNode bool
+	IsRaftLeader bool
+}
+
+// getNodes fetches health status of all known Orchestrator nodes. If discovery is enabled,
+// nodes reported as available by reachable nodes are added to known nodes. Endpoints of a node
+// which has been already reached by another endpoint are skipped.
+// An error is returned only if none of the nodes is reachable.
+func (client *OrchestratorClient) getNodes(ctx context.Context) ([]OrchestratorNode, map[string]HealthStatus, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	var nodes []OrchestratorNode
+	var firstErr error
+	statuses := make(map[string]HealthStatus)
+	// seen are identities of reachable nodes, the same node can be known by several endpoints, e.g. VIP and hostname
+	seen := make(map[string]bool)
+	// Endpoints discovered during the loop are appended and checked as well
+	for i := 0; i < len(client.endpoints); i++ {
+		endpoint := client.endpoints[i]
+		node := OrchestratorNode{Node: endpoint, Endpoint: endpoint}
+		if u, err := url.Parse(endpoint); err == nil {
+			node.Node = u.Host
+		}
+		nodeClient := &OrchestratorClient{apiEndpoint: endpoint, httpClient: client.httpClient}
+		status, err := nodeClient.getStatus(ctx)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			nodes = append(nodes, node)
+			continue
+		}
+		if id := nodeIdentity(status); id != "" {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		statuses[endpoint] = status
+		node.Up = true
+		node.Healthy = status.Details.Healthy
+		node.IsActiveNode = status.Details.IsActiveNode
+		node.IsRaftLeader = status.Details.IsRaftLeader
+		nodes = append(nodes, node)
+
+		if !client.discoverNodes {
+			continue
+		}
+		for _, available := range status.Details.AvailableNodes {
+			peer, err := client.peerEndpoint(available.Hostname)
+			if err != nil || client.isKnownEndpoint(peer) {
+				continue
+			}
+			client.endpoints = append(client.endpoints, peer)
+		}
+	}
+	if len(statuses) == 0 {
+		return nodes, statuses, firstErr
+	}
+	return nodes, statuses, nil
+}
+
+// nodeIdentity returns identity of Orchestrator process which reported status. Token is
+// generated on every start of Orchestrator, hostname is used by versions which do not report it.
+func nodeIdentity(status HealthStatus) string {
+	if status.Details.Token != "" {
+		return status.Details.Token
+	}
+	return status.Details.Hostname
+}
+
+// activeEndpoint returns endpoint of the active node, or of the first reachable node if none is active.
+func activeEndpoint(nodes []OrchestratorNode) string {
+	var endpoint string
+	for _, node := range nodes {
+		if node.Up && node.IsActiveNode {
+			return node.Endpoint
+		}
+		if node.Up && endpoint == "" {
+			endpoint = node.Endpoint
+		}
+	}
+	return endpoint
+}
+
+// peerEndpoint returns API endpoint of Orchestrator node with hostname. Scheme, port and path
+// are the same as of the configured endpoint.
+func (client *OrchestratorClient) peerEndpoint(hostname string) (string, error) {
+	u, err := url.Parse(client.apiEndpoint)
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(hostname, port)
+	} else {
+		u.Host = hostname
+	}
+	return u.String(), nil
+}
+
+func (client *OrchestratorClient) isKnownEndpoint(endpoint string) bool {
+	for _, known := range client.endpoints {
+		if known == endpoint {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+)
+
+// OrchestratorRaft represents raft consensus metrics
+type OrchestratorRaft struct {
+	Enabled bool
+	State   string
+	Leader  string
+	Healthy bool
+	// Peers maps raft peers to their health. Only the leader knows health of peers,
+	// so Peers is nil if the node is not the leader.
+	Peers map[string]bool
+}
+
+// getRaft fetches raft metrics. Raft endpoints are queried only if Orchestrator runs in raft mode.
+func (client *OrchestratorClient) getRaft(ctx context.Context, status HealthStatus) (metric OrchestratorRaft, err error) {
+	if status.Details.RaftAdvertise == "" {
+		return metric, nil
+	}
+	metric.Enabled = true
+	if err = client.get(ctx, "/raft-state", &metric.State); err != nil {
+		return metric, err
+	}
+	if err = client.get(ctx, "/raft-leader", &metric.Leader); err != nil {
+		return metric, err
+	}
+	if metric.Healthy, err = client.getRaftHealth(ctx, "/raft-health"); err != nil {
+		return metric, err
+	}
+	if !status.Details.IsRaftLeader {
+		return metric, nil
+	}
+	var peers []string
+	if err = client.get(ctx, "/raft-peers", &peers); err != nil {
+		return metric, err
+	}
+	metric.Peers = make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		metric.Peers[peer] = false
+	}
+	for _, member := range status.Details.RaftHealthyMembers {
+		metric.Peers[member] = true
+	}
+	return metric, nil
+}
+
+// getRaftHealth checks if the node is a part of a healthy raft group.
+// Orchestrator responds with an error status if it is not.
+func (client *OrchestratorClient) getRaftHealth(ctx context.Context, endpoint string) (bool, error) {
+	var health string
+	err := client.get(ctx, endpoint, &health)
+	if _, ok := err.(*unexpectedStatusError); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return health == "healthy", nil
+}
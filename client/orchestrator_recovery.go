@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxRecoveryPages limits number of /audit-recovery pages read during one scrape
+const maxRecoveryPages = 10
+
+// OrchestratorRecovery represents topology recovery performed by Orchestrator
+type OrchestratorRecovery struct {
+	ID            int64
+	AnalysisEntry struct {
+		Analysis       string
+		ClusterDetails struct {
+			ClusterName  string
+			ClusterAlias string
+		}
+	}
+	IsActive               bool
+	IsSuccessful           bool
+	RecoveryStartTimestamp string
+	RecoveryEndTimestamp   string
+}
+
+// OrchestratorRecoveryKey identifies recoveries of the same kind
+type OrchestratorRecoveryKey struct {
+	ClusterName string
+	Analysis    string
+	Successful  bool
+}
+
+// OrchestratorLastRecovery represents the most recent finished recovery of a cluster
+type OrchestratorLastRecovery struct {
+	Start time.Time
+	End   time.Time
+}
+
+// OrchestratorRecoveries represents recovery history metrics
+type OrchestratorRecoveries struct {
+	LastID int64
+	// Total counts recoveries finished since the exporter has started
+	Total map[OrchestratorRecoveryKey]uint64
+	Last  map[string]OrchestratorLastRecovery
+}
+
+// OrchestratorBlockedRecovery represents recovery blocked by another recent recovery
+type OrchestratorBlockedRecovery struct {
+	FailedInstanceKey    OrchestratorInstanceKey
+	ClusterName          string
+	Analysis             string
+	LastBlockedTimestamp string
+	BlockingRecoveryID   int64 `json:"BlockingRecoveryId"`
+}
+
+// OrchestratorClusterRecoveries represents state of recoveries of MySQL cluster
+type OrchestratorClusterRecoveries struct {
+	// Active is a number of recoveries in progress
+	Active int
+	// Unacknowledged is a number of recent recoveries which block next recoveries until acknowledged
+	Unacknowledged int
+}
+
+// recoveryTracker keeps recovery history between scrapes.
+type recoveryTracker struct {
+	initialized bool
+	lastSeenID  int64
+	total       map[OrchestratorRecoveryKey]uint64
+	last        map[string]OrchestratorLastRecovery
+	mutex       sync.Mutex
+}
+
+func newRecoveryTracker() *recoveryTracker {
+	return &recoveryTracker{
+		total: make(map[OrchestratorRecoveryKey]uint64),
+		last:  make(map[string]OrchestratorLastRecovery),
+	}
+}
+
+// getRecoveries reads recoveries finished since the previous call and returns updated recovery history.
+func (client *OrchestratorClient) getRecoveries(ctx context.Context, endpoint string) (OrchestratorRecoveries, error) {
+	tracker := client.recoveries
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	recoveries, err := client.getNewRecoveries(ctx, endpoint, tracker.lastSeenID, tracker.initialized)
+	if err != nil {
+		return OrchestratorRecoveries{}, err
+	}
+
+	// Recoveries are returned in descending order of ID. They are processed in ascending order
+	// up to the first active one, which will be processed when it is finished.
+	for i := len(recoveries) - 1; i >= 0; i-- {
+		recovery := recoveries[i]
+		if recovery.IsActive {
+			break
+		}
+		tracker.lastSeenID = recovery.ID
+		cluster := recovery.AnalysisEntry.ClusterDetails.ClusterName
+		// Recoveries which happened before the exporter has started are not counted
+		if tracker.initialized {
+			tracker.total[OrchestratorRecoveryKey{
+				ClusterName: cluster,
+				Analysis:    recovery.AnalysisEntry.Analysis,
+				Successful:  recovery.IsSuccessful,
+			}]++
+		}
+		start, startErr := parseOrchestratorTimestamp(recovery.RecoveryStartTimestamp)
+		end, endErr := parseOrchestratorTimestamp(recovery.RecoveryEndTimestamp)
+		if startErr == nil && endErr == nil {
+			tracker.last[cluster] = OrchestratorLastRecovery{Start: start, End: end}
+		}
+	}
+	tracker.initialized = true
+
+	result := OrchestratorRecoveries{
+		LastID: tracker.lastSeenID,
+		Total:  make(map[OrchestratorRecoveryKey]uint64, len(tracker.total)),
+		Last:   make(map[string]OrchestratorLastRecovery, len(tracker.last)),
+	}
+	for key, total := range tracker.total {
+		result.Total[key] = total
+	}
+	for cluster, last := range tracker.last {
+		result.Last[cluster] = last
+	}
+	return result, nil
+}
+
+// getNewRecoveries reads pages of recovery audit until a recovery with lastSeenID is found.
+// On the first call only the most recent page is read.
+func (client *OrchestratorClient) getNewRecoveries(ctx context.Context, endpoint string, lastSeenID int64, initialized bool) ([]OrchestratorRecovery, error) {
+	var recoveries []OrchestratorRecovery
+	for page := 0; page < maxRecoveryPages; page++ {
+		pageRecoveries := []OrchestratorRecovery{}
+		if err := client.get(ctx, fmt.Sprintf("%s/%d", endpoint, page), &pageRecoveries); err != nil {
+			return nil, err
+		}
+		for _, recovery := range pageRecoveries {
+			if recovery.ID <= lastSeenID {
+				return recoveries, nil
+			}
+			recoveries = append(recoveries, recovery)
+		}
+		if len(pageRecoveries) == 0 || !initialized {
+			break
+		}
+	}
+	return recoveries, nil
+}
+
+func (client *OrchestratorClient) getBlockedRecoveries(ctx context.Context, endpoint string) (metric []OrchestratorBlockedRecovery, err error) {
+	err = client.get(ctx, endpoint, &metric)
+	return metric, err
+}
+
+func (client *OrchestratorClient) getClusterRecoveries(ctx context.Context, clusterName string) (metric OrchestratorClusterRecoveries, err error) {
+	var active, unacknowledged []OrchestratorRecovery
+	if err = client.get(ctx, "/active-cluster-recovery/"+url.PathEscape(clusterName), &active); err != nil {
+		return metric, err
+	}
+	if err = client.get(ctx, "/recently-active-cluster-recovery/"+url.PathEscape(clusterName), &unacknowledged); err != nil {
+		return metric, err
+	}
+	metric.Active = len(active)
+	metric.Unacknowledged = len(unacknowledged)
+	return metric, nil
+}
+
+// getGlobalRecoveries checks if recoveries are enabled globally.
+func (client *OrchestratorClient) getGlobalRecoveries(ctx context.Context, endpoint string) (bool, error) {
+	var response struct {
+		Code    string
+		Details string
+	}
+	if err := client.get(ctx, endpoint, &response); err != nil {
+		return false, err
+	}
+	return response.Details == "enabled", nil
+}
+
+// parseOrchestratorTimestamp parses timestamp returned by Orchestrator API.
+// Timestamps without time zone come from Orchestrator backend database and are in local time.
+func parseOrchestratorTimestamp(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse timestamp %q", value)
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -21,23 +22,36 @@ type OrcusMetrics struct {
 	TotalSyncCount          uint64
 }
 
-// NewOrcusClient creates an OrcusClient.
-func NewOrcusClient(httpClient *http.Client, apiEndpoint string) (*OrcusClient, error) {
+// NewOrcusClient creates an OrcusClient. Metrics are fetched within ctx to check Orcus is available.
+func NewOrcusClient(ctx context.Context, httpClient *http.Client, apiEndpoint string) (*OrcusClient, error) {
 	client := &OrcusClient{
 		apiEndpoint: apiEndpoint,
 		httpClient:  httpClient,
 	}
 
-	if _, err := client.GetMetrics(); err != nil {
+	if _, err := client.GetMetrics(ctx); err != nil {
 		return nil, fmt.Errorf("Failed to create Orcus client: %v", err)
 	}
 
 	return client, nil
 }
 
-// GetMetrics fetches Orcus metrics.
-func (client *OrcusClient) GetMetrics() (*OrcusMetrics, error) {
-	resp, err := client.httpClient.Get(client.apiEndpoint)
+// NewOrcusProbeClient creates an OrcusClient for a single probe of apiEndpoint.
+// Availability of Orcus is not checked, it is reported by the scrape.
+func NewOrcusProbeClient(httpClient *http.Client, apiEndpoint string) *OrcusClient {
+	return &OrcusClient{
+		apiEndpoint: apiEndpoint,
+		httpClient:  httpClient,
+	}
+}
+
+// GetMetrics fetches Orcus metrics within ctx.
+func (client *OrcusClient) GetMetrics(ctx context.Context) (*OrcusMetrics, error) {
+	req, err := newRequest(ctx, client.apiEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %v: %v", client.apiEndpoint, err)
 	}
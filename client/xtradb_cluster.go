@@ -1,145 +1,300 @@
 package client
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"database/sql"
 	"fmt"
-	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/MaxFedotov/orcus-exporter/config"
 	"github.com/go-sql-driver/mysql"
-	ini "gopkg.in/ini.v1"
 )
 
-// XtradbClient allows you to get Xtradb cluster metrics.
+// XtradbClient allows you to get Xtradb cluster metrics. Connections to the database
+// are kept open between calls of GetMetrics.
 type XtradbClient struct {
-	dsn string
+	dsn             string
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	// server enables fetching of server health metrics
+	server bool
+	// nodes are all known nodes of the cluster, the first one is the node from DATA_SOURCE_NAME or my.cnf
+	nodes         []*xtradbNode
+	discoverNodes bool
+	mutex         sync.Mutex
+	// closed is set by Close, connections are not opened after that
+	closed bool
+	// user and password are used to redact DSN in errors
+	user     string
+	password string
 }
 
-// XtradbMetrics represents Xtradb cluster metrics.
+// XtradbMetrics represents Xtradb cluster node metrics.
 type XtradbMetrics struct {
-	ClusterSize   int
-	NodeState     int
-	ClusterStatus int
+	// Node is address of the node
+	Node string
+	// Err is set if metrics of the node could not be fetched. Other fields are empty then.
+	Err         error
+	ClusterSize int
+	// ClusterStateUUID and ClusterConfID are the same on all nodes of a consistent cluster.
+	// ClusterConfID is -1 if it is undefined, e.g. on nodes of non-Primary component.
+	ClusterStateUUID string
+	ClusterConfID    int64
+	// NodeState is a state of the node, e.g. Synced or Donor/Desynced
+	NodeState string
+	// ClusterStatus is a status of the cluster component the node belongs to: Primary, non-Primary or Disconnected
+	ClusterStatus string
+	// FlowControlPaused is a fraction of time replication was paused by flow control
+	FlowControlPaused float64
+	FlowControlSent   uint64
+	FlowControlRecv   uint64
+	LocalSendQueueAvg float64
+	LocalRecvQueueAvg float64
+	LocalCertFailures uint64
+	LocalBfAborts     uint64
+	ReplicatedBytes   uint64
+	ReceivedBytes     uint64
+	Ready             bool
+	Connected         bool
+	EVSState          string
+	LastCommitted     int64
+	// LocalCachedDownto is the lowest sequence number in gcache, which can be sent with IST.
+	// It is -1 if gcache is empty, e.g. right after SST, or the node does not report it.
+	LocalCachedDownto int64
+	// StateTransfer is nil if the node neither donates nor receives state
+	StateTransfer *XtradbStateTransfer
+	// IncomingAddresses are client addresses of cluster nodes reported by the node
+	IncomingAddresses []string
+	// Server is nil if fetching of server health metrics is disabled or failed with ServerErr
+	Server    *XtradbServerMetrics
+	ServerErr error
+	// gcommUUID identifies the node process, it is used to report a node known by several addresses once
+	gcommUUID string
 }
 
-// NewXtradbClient creates an XtradbClient.
-func NewXtradbClient(myCnf string, sslVerify bool) (*XtradbClient, error) {
-	dsn, err := parseMycnf(myCnf, sslVerify)
+// NewXtradbClient creates an XtradbClient. The node from dsn built by XtradbDSN and cfg.Nodes
+// are scraped with the same credentials. If cfg.DiscoverNodes is true, nodes from wsrep_incoming_addresses
+// are scraped as well. Metrics are fetched within ctx to check the cluster is available.
+func NewXtradbClient(ctx context.Context, dsn string, cfg config.XtradbCollector) (*XtradbClient, error) {
+	mysqlCfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse my.cnf for Xtradb cluster client: %v", err)
+		return nil, fmt.Errorf("Failed to configure Xtradb cluster client: %v", err)
 	}
 
 	client := &XtradbClient{
-		dsn: dsn,
+		dsn:             dsn,
+		user:            mysqlCfg.User,
+		password:        mysqlCfg.Passwd,
+		maxOpenConns:    cfg.MaxOpenConns,
+		maxIdleConns:    cfg.MaxIdleConns,
+		connMaxLifetime: cfg.ConnMaxLifetime,
+		discoverNodes:   cfg.DiscoverNodes,
+		server:          cfg.Server,
+	}
+	if err := client.addNode("", false); err != nil {
+		return nil, fmt.Errorf("Failed to configure Xtradb cluster client: %v", client.redact(err))
+	}
+	for _, address := range cfg.Nodes {
+		if err := client.addNode(address, false); err != nil {
+			return nil, fmt.Errorf("Invalid Xtradb cluster node %s: %v", address, client.redact(err))
+		}
 	}
 
-	if _, err := client.GetMetrics(); err != nil {
+	if _, err := client.GetMetrics(ctx); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("Failed to create Xtradb cluster client: %v", err)
 	}
 
 	return client, nil
 }
 
-func parseMycnf(myCnf string, sslVerify bool) (string, error) {
-	var dsn string
-	opts := ini.LoadOptions{
-		// MySQL ini file can have boolean keys.
-		AllowBooleanKeys: true,
+// getNodeMetrics fetches metrics of Xtradb cluster node within ctx.
+func (client *XtradbClient) getNodeMetrics(ctx context.Context, node *xtradbNode) (*XtradbMetrics, error) {
+	db, err := client.connect(ctx, node)
+	if err != nil {
+		return nil, err
 	}
-	cfg, err := ini.LoadSources(opts, myCnf)
+	status, err := queryVariables(ctx, db, "SHOW GLOBAL STATUS LIKE 'wsrep_%';")
 	if err != nil {
-		return dsn, fmt.Errorf("failed reading ini file: %s", err)
-	}
-	user := cfg.Section("client").Key("user").String()
-	password := cfg.Section("client").Key("password").String()
-	if (user == "") || (password == "") {
-		return dsn, fmt.Errorf("no user or password specified under [client] in %s", myCnf)
-	}
-	host := cfg.Section("client").Key("host").MustString("localhost")
-	port := cfg.Section("client").Key("port").MustUint(3306)
-	socket := cfg.Section("client").Key("socket").String()
-	if socket != "" {
-		dsn = fmt.Sprintf("%s:%s@unix(%s)/", user, password, socket)
-	} else {
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/", user, password, host, port)
-	}
-	sslCA := cfg.Section("client").Key("ssl-ca").String()
-	sslCert := cfg.Section("client").Key("ssl-cert").String()
-	sslKey := cfg.Section("client").Key("ssl-key").String()
-	if sslCA != "" {
-		if tlsErr := customizeTLS(sslCA, sslCert, sslKey, sslVerify); tlsErr != nil {
-			tlsErr = fmt.Errorf("failed to register a custom TLS configuration for mysql dsn: %s", tlsErr)
-			return dsn, tlsErr
-		}
-		dsn = fmt.Sprintf("%s?tls=custom", dsn)
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
+	}
+	variables, err := queryVariables(ctx, db, "SHOW GLOBAL VARIABLES WHERE Variable_name IN ('wsrep_sst_method', 'wsrep_desync');")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
 	}
 
-	return dsn, nil
+	metrics, err := node.parseStatus(status, variables)
+	if err != nil {
+		return nil, err
+	}
+	// Server health metrics are optional, the node is reported without them if they can not be fetched
+	if client.server {
+		metrics.Server, metrics.ServerErr = getServerMetrics(ctx, db)
+		metrics.ServerErr = client.redact(metrics.ServerErr)
+	}
+	return metrics, nil
 }
 
-func customizeTLS(sslCA string, sslCert string, sslKey string, sslVerify bool) error {
-	var tlsCfg tls.Config
-	caBundle := x509.NewCertPool()
-	pemCA, err := ioutil.ReadFile(sslCA)
-	if err != nil {
-		return err
+// parseStatus builds metrics of the node from its status and system variables.
+func (node *xtradbNode) parseStatus(status map[string]string, variables map[string]string) (*XtradbMetrics, error) {
+	metrics := XtradbMetrics{Node: node.address}
+	p := &statusParser{status: status}
+	metrics.ClusterSize = int(p.getInt("wsrep_cluster_size"))
+	metrics.ClusterStateUUID = p.getString("wsrep_cluster_state_uuid")
+	metrics.ClusterConfID = p.getSigned("wsrep_cluster_conf_id")
+	metrics.NodeState = p.getString("wsrep_local_state_comment")
+	metrics.ClusterStatus = p.getString("wsrep_cluster_status")
+	metrics.FlowControlPaused = p.getFloat("wsrep_flow_control_paused")
+	metrics.FlowControlSent = p.getUint("wsrep_flow_control_sent")
+	metrics.FlowControlRecv = p.getUint("wsrep_flow_control_recv")
+	metrics.LocalSendQueueAvg = p.getFloat("wsrep_local_send_queue_avg")
+	metrics.LocalRecvQueueAvg = p.getFloat("wsrep_local_recv_queue_avg")
+	metrics.LocalCertFailures = p.getUint("wsrep_local_cert_failures")
+	metrics.LocalBfAborts = p.getUint("wsrep_local_bf_aborts")
+	metrics.ReplicatedBytes = p.getUint("wsrep_replicated_bytes")
+	metrics.ReceivedBytes = p.getUint("wsrep_received_bytes")
+	metrics.Ready = p.getBool("wsrep_ready")
+	metrics.Connected = p.getBool("wsrep_connected")
+	metrics.EVSState = p.getString("wsrep_evs_state")
+	metrics.LastCommitted = p.getInt("wsrep_last_committed")
+	metrics.LocalCachedDownto = -1
+	if p.has("wsrep_local_cached_downto") {
+		metrics.LocalCachedDownto = p.getSigned("wsrep_local_cached_downto")
+	}
+	// Nodes of old versions do not report wsrep_gcomm_uuid, they are identified by address only
+	metrics.gcommUUID = status["wsrep_gcomm_uuid"]
+	metrics.StateTransfer = node.trackStateTransfer(metrics.NodeState, p, variables)
+	if p.err != nil {
+		return nil, p.err
 	}
-	if ok := caBundle.AppendCertsFromPEM(pemCA); ok {
-		tlsCfg.RootCAs = caBundle
-	} else {
-		return fmt.Errorf("failed parse pem-encoded CA certificates from %s", sslCA)
+	for _, address := range strings.Split(status["wsrep_incoming_addresses"], ",") {
+		// Nodes without configured address report AUTO
+		if address = strings.TrimSpace(address); address != "" && address != "AUTO" {
+			metrics.IncomingAddresses = append(metrics.IncomingAddresses, address)
+		}
 	}
-	if sslCert != "" && sslKey != "" {
-		certPairs := make([]tls.Certificate, 0, 1)
-		keypair, err := tls.LoadX509KeyPair(sslCert, sslKey)
+	return &metrics, nil
+}
+
+// connect returns a database handle of node which is checked to be alive within ctx.
+// If the check fails, the handle is closed and a new one is opened on the next call.
+func (client *XtradbClient) connect(ctx context.Context, node *xtradbNode) (*sql.DB, error) {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	if node.db == nil {
+		db, err := sql.Open("mysql", node.dsn)
 		if err != nil {
-			return fmt.Errorf("failed to parse pem-encoded SSL cert %s or SSL key %s: %s",
-				sslCert, sslKey, err)
+			return nil, fmt.Errorf("failed to open connection to database: %v", err)
 		}
-		certPairs = append(certPairs, keypair)
-		tlsCfg.Certificates = certPairs
-		tlsCfg.InsecureSkipVerify = !sslVerify
+		db.SetMaxOpenConns(client.maxOpenConns)
+		db.SetMaxIdleConns(client.maxIdleConns)
+		db.SetConnMaxLifetime(client.connMaxLifetime)
+		node.db = db
+	}
+	if err := node.db.PingContext(ctx); err != nil {
+		node.db.Close()
+		node.db = nil
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
-	mysql.RegisterTLSConfig("custom", &tlsCfg)
-	return nil
+	return node.db, nil
 }
 
-// GetMetrics fetches Xtradb cluster metrics.
-func (client *XtradbClient) GetMetrics() (*XtradbMetrics, error) {
-	var clusterSize, nodeState, clusterStatus int
-	var clusterStatusDesc string
-	var variableName string
-	var metrics XtradbMetrics
-	db, err := sql.Open("mysql", client.dsn)
+// queryVariables reads names and values of status or system variables returned by query.
+func queryVariables(ctx context.Context, db *sql.DB, query string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open connection to database: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		status[strings.ToLower(name)] = value
+	}
+	return status, rows.Err()
+}
+
+// statusParser converts values of status variables. The first error is kept in err
+// and zero values are returned after it.
+type statusParser struct {
+	status map[string]string
+	err    error
+}
+
+func (p *statusParser) has(name string) bool {
+	_, ok := p.status[name]
+	return ok
+}
+
+func (p *statusParser) getString(name string) string {
+	if p.err != nil {
+		return ""
 	}
-	defer db.Close()
-	db.SetMaxOpenConns(1)
-	db.SetMaxIdleConns(1)
-	db.SetConnMaxLifetime(1 * time.Minute)
-	err = db.QueryRow("SHOW STATUS LIKE 'wsrep_cluster_size';").Scan(&variableName, &clusterSize)
+	value, ok := p.status[name]
+	if !ok {
+		p.err = fmt.Errorf("status variable %s not found", name)
+	}
+	return value
+}
+
+func (p *statusParser) getInt(name string) int64 {
+	value := p.getString(name)
+	if p.err != nil {
+		return 0
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get data from database: %v", err)
+		p.err = fmt.Errorf("failed to parse status variable %s: %v", name, err)
+	}
+	return i
+}
+
+func (p *statusParser) getUint(name string) uint64 {
+	value := p.getString(name)
+	if p.err != nil {
+		return 0
 	}
-	err = db.QueryRow("SHOW STATUS LIKE 'wsrep_local_state';").Scan(&variableName, &nodeState)
+	u, err := strconv.ParseUint(value, 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get data from database: %v", err)
+		p.err = fmt.Errorf("failed to parse status variable %s: %v", name, err)
+	}
+	return u
+}
+
+// getSigned parses a signed value Galera reports as unsigned, e.g. 18446744073709551615 stands for -1.
+func (p *statusParser) getSigned(name string) int64 {
+	return int64(p.getUint(name))
+}
+
+func (p *statusParser) getFloat(name string) float64 {
+	value := p.getString(name)
+	if p.err != nil {
+		return 0
 	}
-	err = db.QueryRow("SHOW STATUS LIKE 'wsrep_cluster_status';").Scan(&variableName, &clusterStatusDesc)
+	f, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get data from database: %v", err)
+		p.err = fmt.Errorf("failed to parse status variable %s: %v", name, err)
 	}
-	switch clusterStatusDesc {
-	case "Primary":
-		clusterStatus = 1
+	return f
+}
+
+func (p *statusParser) getBool(name string) bool {
+	switch value := p.getString(name); value {
+	case "ON":
+		return true
+	case "OFF", "":
+		return false
 	default:
-		clusterStatus = 0
+		p.err = fmt.Errorf("failed to parse status variable %s: invalid value %q", name, value)
+		return false
 	}
-	metrics.ClusterSize = clusterSize
-	metrics.NodeState = nodeState
-	metrics.ClusterStatus = clusterStatus
-	return &metrics, nil
 }
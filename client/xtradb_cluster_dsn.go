@@ -0,0 +1,106 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/MaxFedotov/orcus-exporter/config"
+	"github.com/go-sql-driver/mysql"
+)
+
+// redactedPassword replaces the password in errors
+const redactedPassword = "******"
+
+// XtradbDSN builds DSN of the Xtradb cluster node from cfg. Connection settings are taken from
+// cfg.DSN if it is set, otherwise from my.cnf. cfg.Host, cfg.Port, credentials from cfg.UserFile
+// and cfg.PasswordFile and TLS files from cfg.TLS take precedence over both.
+func XtradbDSN(cfg config.XtradbCollector) (string, error) {
+	var mysqlCfg *mysql.Config
+	if cfg.DSN != "" {
+		var err error
+		if mysqlCfg, err = mysql.ParseDSN(cfg.DSN); err != nil {
+			return "", fmt.Errorf("invalid DATA_SOURCE_NAME: %v", err)
+		}
+		// Timeouts set in DATA_SOURCE_NAME are kept
+		if mysqlCfg.Timeout == 0 {
+			mysqlCfg.Timeout = cfg.Timeout
+		}
+		if mysqlCfg.ReadTimeout == 0 {
+			mysqlCfg.ReadTimeout = cfg.Timeout
+		}
+		if mysqlCfg.WriteTimeout == 0 {
+			mysqlCfg.WriteTimeout = cfg.Timeout
+		}
+		if cfg.TLS.CAFile != "" {
+			if err := customizeTLS("xtradb_cluster", "", cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.SSLVerify); err != nil {
+				return "", fmt.Errorf("failed to register a custom TLS configuration for mysql dsn: %s", err)
+			}
+			mysqlCfg.TLSConfig = "xtradb_cluster"
+		}
+	} else {
+		dsn, err := parseMycnf(mycnfOptions{
+			myCnf:     cfg.MyCnf,
+			section:   cfg.MyCnfSection,
+			loginPath: cfg.LoginPath,
+			tlsName:   "xtradb_cluster",
+			tls:       cfg.TLS,
+			timeout:   cfg.Timeout,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to parse my.cnf: %v", err)
+		}
+		if mysqlCfg, err = mysql.ParseDSN(dsn); err != nil {
+			return "", fmt.Errorf("failed to parse my.cnf: %v", err)
+		}
+	}
+
+	if cfg.UserFile != "" {
+		user, err := config.ReadSecretFile(cfg.UserFile)
+		if err != nil {
+			return "", err
+		}
+		mysqlCfg.User = user
+	}
+	if cfg.PasswordFile != "" {
+		password, err := config.ReadSecretFile(cfg.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		mysqlCfg.Passwd = password
+	}
+	if cfg.Host != "" || cfg.Port != 0 {
+		host, port := "localhost", "3306"
+		if mysqlCfg.Net == "tcp" {
+			var err error
+			if host, port, err = net.SplitHostPort(mysqlCfg.Addr); err != nil {
+				return "", fmt.Errorf("invalid address %s: %v", mysqlCfg.Addr, err)
+			}
+		}
+		if cfg.Host != "" {
+			host = cfg.Host
+		}
+		if cfg.Port != 0 {
+			port = strconv.Itoa(cfg.Port)
+		}
+		// Socket is replaced, because it can not be combined with host and port
+		mysqlCfg.Net = "tcp"
+		mysqlCfg.Addr = net.JoinHostPort(host, port)
+	}
+	return mysqlCfg.FormatDSN(), nil
+}
+
+// redact replaces the password in user:password@ segments of DSN in err, so it is not exposed in logs.
+// Other occurrences of the password are kept, they can not be told from the rest of the text.
+func (client *XtradbClient) redact(err error) error {
+	if err == nil || client.password == "" {
+		return err
+	}
+	credentials := client.user + ":" + client.password + "@"
+	if !strings.Contains(err.Error(), credentials) {
+		return err
+	}
+	return errors.New(strings.Replace(err.Error(), credentials, client.user+":"+redactedPassword+"@", -1))
+}
@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// xtradbNode represents Xtradb cluster node and connections to it
+type xtradbNode struct {
+	address string
+	dsn     string
+	db      *sql.DB
+	mutex   sync.Mutex
+	// discovered is set for nodes from wsrep_incoming_addresses, they are removed when no node reports them
+	discovered bool
+	// transfer is the state transfer in progress detected by the previous scrape
+	transfer *XtradbStateTransfer
+}
+
+// XtradbClusterMetrics represents metrics of all known Xtradb cluster nodes.
+type XtradbClusterMetrics struct {
+	Nodes []XtradbMetrics
+}
+
+// GetMetrics fetches metrics of all known Xtradb cluster nodes concurrently within ctx.
+// A node known by several addresses is reported once, by the first of them.
+// An error is returned only if none of the nodes is reachable.
+func (client *XtradbClient) GetMetrics(ctx context.Context) (*XtradbClusterMetrics, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return nil, errors.New("client is closed")
+	}
+	var metrics XtradbClusterMetrics
+	// seen are identities of reachable nodes, the same node can be known by several addresses, e.g. localhost and IP
+	seen := make(map[string]bool)
+	// Nodes discovered during the scrape are scraped in the next round
+	for scraped := 0; scraped < len(client.nodes); {
+		nodes := client.nodes[scraped:]
+		scraped = len(client.nodes)
+
+		results := make([]XtradbMetrics, len(nodes))
+		var wg sync.WaitGroup
+		wg.Add(len(nodes))
+		for i, node := range nodes {
+			go func(i int, node *xtradbNode) {
+				defer wg.Done()
+				nodeMetrics, err := client.getNodeMetrics(ctx, node)
+				if err != nil {
+					results[i] = XtradbMetrics{Node: node.address, Err: client.redact(err)}
+					return
+				}
+				results[i] = *nodeMetrics
+			}(i, node)
+		}
+		wg.Wait()
+		for _, nodeMetrics := range results {
+			if nodeMetrics.gcommUUID != "" {
+				if seen[nodeMetrics.gcommUUID] {
+					continue
+				}
+				seen[nodeMetrics.gcommUUID] = true
+			}
+			metrics.Nodes = append(metrics.Nodes, nodeMetrics)
+		}
+
+		if !client.discoverNodes {
+			continue
+		}
+		for _, nodeMetrics := range results {
+			for _, address := range nodeMetrics.IncomingAddresses {
+				// Invalid addresses are ignored, they are reported by the node and not configured
+				client.addNode(address, true)
+			}
+		}
+	}
+	if client.discoverNodes {
+		metrics.Nodes = client.removeStaleNodes(metrics.Nodes)
+	}
+
+	matchStateTransferPeers(metrics.Nodes)
+	for _, nodeMetrics := range metrics.Nodes {
+		if nodeMetrics.Err == nil {
+			return &metrics, nil
+		}
+	}
+	return nil, metrics.Nodes[0].Err
+}
+
+// Close closes connections to all known nodes. It waits for GetMetrics in progress to finish,
+// calls of GetMetrics after that fail.
+func (client *XtradbClient) Close() error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.closed = true
+	var err error
+	for _, node := range client.nodes {
+		if closeErr := node.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// close closes connections to the node.
+func (node *xtradbNode) close() error {
+	node.mutex.Lock()
+	defer node.mutex.Unlock()
+
+	if node.db == nil {
+		return nil
+	}
+	err := node.db.Close()
+	node.db = nil
+	return err
+}
+
+// addNode adds node with address to known nodes. Empty address stands for the node from DATA_SOURCE_NAME or my.cnf.
+func (client *XtradbClient) addNode(address string, discovered bool) error {
+	cfg, err := client.nodeConfig(address)
+	if err != nil {
+		return err
+	}
+	for _, node := range client.nodes {
+		if node.address == cfg.Addr {
+			return nil
+		}
+	}
+	client.nodes = append(client.nodes, &xtradbNode{
+		address:    cfg.Addr,
+		dsn:        cfg.FormatDSN(),
+		discovered: discovered,
+	})
+	return nil
+}
+
+// nodeConfig returns connection settings of the node with address.
+func (client *XtradbClient) nodeConfig(address string) (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(client.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if address != "" {
+		cfg.Net = "tcp"
+		cfg.Addr = address
+		// Format and parse DSN again to get the address normalized
+		if cfg, err = mysql.ParseDSN(cfg.FormatDSN()); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// removeStaleNodes removes discovered nodes which none of reachable nodes reports any more,
+// e.g. nodes removed from the cluster, and returns metrics without them. Nodes are kept
+// if no addresses are reported, e.g. all nodes are unreachable.
+func (client *XtradbClient) removeStaleNodes(metrics []XtradbMetrics) []XtradbMetrics {
+	reported := make(map[string]bool)
+	for _, nodeMetrics := range metrics {
+		for _, address := range nodeMetrics.IncomingAddresses {
+			if cfg, err := client.nodeConfig(address); err == nil {
+				reported[cfg.Addr] = true
+			}
+		}
+	}
+	if len(reported) == 0 {
+		return metrics
+	}
+
+	stale := make(map[string]bool)
+	var nodes []*xtradbNode
+	for _, node := range client.nodes {
+		if node.discovered && !reported[node.address] {
+			stale[node.address] = true
+			node.close()
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	client.nodes = nodes
+
+	var result []XtradbMetrics
+	for _, nodeMetrics := range metrics {
+		if !stale[nodeMetrics.Node] {
+			result = append(result, nodeMetrics)
+		}
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// XtradbServerMetrics represents health metrics of MySQL server of Xtradb cluster node.
+type XtradbServerMetrics struct {
+	Uptime           time.Duration
+	ThreadsConnected uint64
+	ThreadsRunning   uint64
+	MaxConnections   uint64
+	AbortedConnects  uint64
+	// BufferPoolReadRequests are logical reads, BufferPoolReads are reads which missed buffer pool
+	BufferPoolReadRequests uint64
+	BufferPoolReads        uint64
+	RowLockWaits           uint64
+	RowLockTime            time.Duration
+	// Deadlocks is invalid if the server does not report it, e.g. MySQL with Galera from Codership
+	Deadlocks sql.NullInt64
+}
+
+// BufferPoolHitRatio returns fraction of logical reads served from InnoDB buffer pool since server start.
+func (metrics *XtradbServerMetrics) BufferPoolHitRatio() float64 {
+	if metrics.BufferPoolReadRequests == 0 {
+		return 1
+	}
+	return 1 - float64(metrics.BufferPoolReads)/float64(metrics.BufferPoolReadRequests)
+}
+
+// getServerMetrics fetches server health metrics within ctx.
+func getServerMetrics(ctx context.Context, db *sql.DB) (*XtradbServerMetrics, error) {
+	status, err := queryVariables(ctx, db, "SHOW GLOBAL STATUS WHERE Variable_name IN ("+
+		"'Uptime', 'Threads_connected', 'Threads_running', 'Aborted_connects', "+
+		"'Innodb_buffer_pool_read_requests', 'Innodb_buffer_pool_reads', "+
+		"'Innodb_row_lock_waits', 'Innodb_row_lock_time', 'Innodb_deadlocks');")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
+	}
+	variables, err := queryVariables(ctx, db, "SHOW GLOBAL VARIABLES WHERE Variable_name = 'max_connections';")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data from database: %v", err)
+	}
+	for name, value := range variables {
+		status[name] = value
+	}
+
+	var metrics XtradbServerMetrics
+	p := &statusParser{status: status}
+	metrics.Uptime = time.Duration(p.getUint("uptime")) * time.Second
+	metrics.ThreadsConnected = p.getUint("threads_connected")
+	metrics.ThreadsRunning = p.getUint("threads_running")
+	metrics.MaxConnections = p.getUint("max_connections")
+	metrics.AbortedConnects = p.getUint("aborted_connects")
+	metrics.BufferPoolReadRequests = p.getUint("innodb_buffer_pool_read_requests")
+	metrics.BufferPoolReads = p.getUint("innodb_buffer_pool_reads")
+	metrics.RowLockWaits = p.getUint("innodb_row_lock_waits")
+	metrics.RowLockTime = time.Duration(p.getUint("innodb_row_lock_time")) * time.Millisecond
+	if p.has("innodb_deadlocks") {
+		metrics.Deadlocks = sql.NullInt64{Int64: p.getInt("innodb_deadlocks"), Valid: true}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &metrics, nil
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Roles of Xtradb cluster node in state transfer
+const (
+	XtradbDonor  = "donor"
+	XtradbJoiner = "joiner"
+)
+
+// XtradbStateTransfer represents state transfer (SST or IST) in progress
+type XtradbStateTransfer struct {
+	// Role is XtradbDonor or XtradbJoiner
+	Role string
+	// Method is IST or SST method of the node, e.g. xtrabackup-v2 or rsync
+	Method string
+	// Peer is the other node of the transfer, empty if it is unknown
+	Peer string
+	// Start is the time the exporter has detected the transfer
+	Start time.Time
+	// ISTSeqnoStart, ISTSeqnoCurrent and ISTSeqnoEnd represent progress of IST received by joiner
+	ISTSeqnoStart   int64
+	ISTSeqnoCurrent int64
+	ISTSeqnoEnd     int64
+}
+
+// IsIST returns true if the transfer is IST with known progress.
+func (transfer *XtradbStateTransfer) IsIST() bool {
+	return transfer.ISTSeqnoEnd > 0
+}
+
+// trackStateTransfer detects state transfer in progress from the node state and status
+// and system variables. Start of the transfer is kept between scrapes of the node.
+func (node *xtradbNode) trackStateTransfer(nodeState string, p *statusParser, variables map[string]string) *XtradbStateTransfer {
+	var role string
+	switch {
+	// Node desynced manually with wsrep_desync has the same state as donor
+	case nodeState == "Donor/Desynced" && !strings.EqualFold(variables["wsrep_desync"], "ON"):
+		role = XtradbDonor
+	case strings.HasPrefix(nodeState, "Joining"):
+		role = XtradbJoiner
+	default:
+		node.transfer = nil
+		return nil
+	}
+
+	transfer := &XtradbStateTransfer{
+		Role:   role,
+		Method: variables["wsrep_sst_method"],
+		Start:  time.Now(),
+	}
+	if role == XtradbJoiner {
+		transfer.ISTSeqnoStart, transfer.ISTSeqnoCurrent, transfer.ISTSeqnoEnd = getISTProgress(p)
+		if transfer.IsIST() {
+			transfer.Method = "IST"
+		}
+	}
+	if node.transfer != nil && node.transfer.Role == transfer.Role {
+		transfer.Start = node.transfer.Start
+	}
+	node.transfer = transfer
+	return transfer
+}
+
+// getISTProgress reads progress of IST received by the node. Galera reports it with
+// wsrep_ist_receive_seqno_* status variables and Percona XtraDB Cluster with wsrep_ist_receive_status.
+func getISTProgress(p *statusParser) (start int64, current int64, end int64) {
+	if p.has("wsrep_ist_receive_seqno_end") {
+		return p.getInt("wsrep_ist_receive_seqno_start"), p.getInt("wsrep_ist_receive_seqno_current"),
+			p.getInt("wsrep_ist_receive_seqno_end")
+	}
+	if p.has("wsrep_ist_receive_status") {
+		var percent int
+		// Status is empty if IST is not in progress
+		fmt.Sscanf(p.getString("wsrep_ist_receive_status"), "%d%% complete, received seqno %d of %d-%d",
+			&percent, &current, &start, &end)
+	}
+	return start, current, end
+}
+
+// matchStateTransferPeers sets unknown peers of state transfers to nodes with the opposite role
+// if there is only one such node.
+func matchStateTransferPeers(nodes []XtradbMetrics) {
+	peers := make(map[string][]string)
+	for _, node := range nodes {
+		if node.StateTransfer != nil {
+			peers[node.StateTransfer.Role] = append(peers[node.StateTransfer.Role], node.Node)
+		}
+	}
+	for _, node := range nodes {
+		transfer := node.StateTransfer
+		if transfer == nil || transfer.Peer != "" {
+			continue
+		}
+		opposite := XtradbDonor
+		if transfer.Role == XtradbDonor {
+			opposite = XtradbJoiner
+		}
+		if len(peers[opposite]) == 1 {
+			transfer.Peer = peers[opposite][0]
+		}
+	}
+}
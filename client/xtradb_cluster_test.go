@@ -0,0 +1,150 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStatusParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		get    func(p *statusParser) interface{}
+		result interface{}
+		err    bool
+	}{
+		{name: "int", value: "42", get: func(p *statusParser) interface{} { return p.getInt("v") }, result: int64(42)},
+		{name: "negative int", value: "-1", get: func(p *statusParser) interface{} { return p.getInt("v") }, result: int64(-1)},
+		{name: "int overflow", value: "18446744073709551615", get: func(p *statusParser) interface{} { return p.getInt("v") }, result: int64(9223372036854775807), err: true},
+		{name: "uint", value: "18446744073709551615", get: func(p *statusParser) interface{} { return p.getUint("v") }, result: uint64(18446744073709551615)},
+		{name: "signed", value: "12", get: func(p *statusParser) interface{} { return p.getSigned("v") }, result: int64(12)},
+		// wsrep_cluster_conf_id of a node of non-Primary component
+		{name: "signed undefined", value: "18446744073709551615", get: func(p *statusParser) interface{} { return p.getSigned("v") }, result: int64(-1)},
+		{name: "signed invalid", value: "-1", get: func(p *statusParser) interface{} { return p.getSigned("v") }, result: int64(0), err: true},
+		{name: "float", value: "0.25", get: func(p *statusParser) interface{} { return p.getFloat("v") }, result: 0.25},
+		{name: "bool", value: "ON", get: func(p *statusParser) interface{} { return p.getBool("v") }, result: true},
+		{name: "bool invalid", value: "YES", get: func(p *statusParser) interface{} { return p.getBool("v") }, result: false, err: true},
+	}
+	for _, test := range tests {
+		p := &statusParser{status: map[string]string{"v": test.value}}
+		if result := test.get(p); result != test.result {
+			t.Errorf("%s: expected %v, got %v", test.name, test.result, result)
+		}
+		if (p.err != nil) != test.err {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.err, p.err)
+		}
+	}
+
+	p := &statusParser{status: map[string]string{}}
+	if p.getInt("missing"); p.err == nil {
+		t.Errorf("expected error for missing variable")
+	}
+}
+
+// xtradbStatus returns status variables of a synced node with overrides applied.
+func xtradbStatus(overrides map[string]string) map[string]string {
+	status := map[string]string{
+		"wsrep_cluster_size":         "3",
+		"wsrep_cluster_state_uuid":   "c2883338-834d-11e2-0800-03c9c68e41ec",
+		"wsrep_cluster_conf_id":      "7",
+		"wsrep_local_state_comment":  "Synced",
+		"wsrep_cluster_status":       "Primary",
+		"wsrep_flow_control_paused":  "0.1",
+		"wsrep_flow_control_sent":    "1",
+		"wsrep_flow_control_recv":    "2",
+		"wsrep_local_send_queue_avg": "0.5",
+		"wsrep_local_recv_queue_avg": "1.5",
+		"wsrep_local_cert_failures":  "3",
+		"wsrep_local_bf_aborts":      "4",
+		"wsrep_replicated_bytes":     "100",
+		"wsrep_received_bytes":       "200",
+		"wsrep_ready":                "ON",
+		"wsrep_connected":            "ON",
+		"wsrep_evs_state":            "OPERATIONAL",
+		"wsrep_last_committed":       "1000",
+		"wsrep_local_cached_downto":  "900",
+		"wsrep_incoming_addresses":   "10.0.0.1:3306,10.0.0.2:3306,AUTO",
+		"wsrep_gcomm_uuid":           "6c5a8c4c-834d-11e2-a96d-bf1c7d1e9c33",
+	}
+	for name, value := range overrides {
+		status[name] = value
+	}
+	return status
+}
+
+func TestXtradbNodeParseStatus(t *testing.T) {
+	tests := []struct {
+		name              string
+		overrides         map[string]string
+		confID            int64
+		localCachedDownto int64
+	}{
+		{name: "synced", confID: 7, localCachedDownto: 900},
+		// Nodes of non-Primary component report undefined conf_id
+		{name: "non-Primary", overrides: map[string]string{"wsrep_cluster_status": "non-Primary", "wsrep_cluster_conf_id": "18446744073709551615"},
+			confID: -1, localCachedDownto: 900},
+		// gcache is empty right after SST
+		{name: "empty gcache", overrides: map[string]string{"wsrep_local_cached_downto": "18446744073709551615"},
+			confID: 7, localCachedDownto: -1},
+	}
+	for _, test := range tests {
+		node := &xtradbNode{address: "10.0.0.1:3306"}
+		metrics, err := node.parseStatus(xtradbStatus(test.overrides), map[string]string{})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if metrics.ClusterConfID != test.confID {
+			t.Errorf("%s: expected conf_id %d, got %d", test.name, test.confID, metrics.ClusterConfID)
+		}
+		if metrics.LocalCachedDownto != test.localCachedDownto {
+			t.Errorf("%s: expected local_cached_downto %d, got %d", test.name, test.localCachedDownto, metrics.LocalCachedDownto)
+		}
+		if metrics.gcommUUID == "" {
+			t.Errorf("%s: expected gcomm UUID to be set", test.name)
+		}
+		if len(metrics.IncomingAddresses) != 2 {
+			t.Errorf("%s: unexpected incoming addresses %v", test.name, metrics.IncomingAddresses)
+		}
+	}
+}
+
+func TestXtradbRemoveStaleNodes(t *testing.T) {
+	client := &XtradbClient{dsn: "user:pass@tcp(localhost:3306)/", discoverNodes: true}
+	client.addNode("", false)
+	client.addNode("10.0.0.9:3306", false)
+	client.addNode("10.0.0.1", true)
+	client.addNode("10.0.0.2:3306", true)
+	metrics := []XtradbMetrics{
+		// Reported addresses are normalized the same way as addresses of known nodes
+		{Node: "localhost:3306", IncomingAddresses: []string{"10.0.0.1"}},
+		{Node: "10.0.0.9:3306", Err: errors.New("failed")},
+		{Node: "10.0.0.1:3306", IncomingAddresses: []string{"10.0.0.1:3306"}},
+		{Node: "10.0.0.2:3306", Err: errors.New("failed")},
+	}
+
+	result := client.removeStaleNodes(metrics)
+	var nodes []string
+	for _, nodeMetrics := range result {
+		nodes = append(nodes, nodeMetrics.Node)
+	}
+	// Configured nodes are kept even if they are not reported
+	expected := []string{"localhost:3306", "10.0.0.9:3306", "10.0.0.1:3306"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected metrics of %v, got %v", expected, nodes)
+	}
+	var known []string
+	for _, node := range client.nodes {
+		known = append(known, node.address)
+	}
+	if !reflect.DeepEqual(known, expected) {
+		t.Errorf("expected known nodes %v, got %v", expected, known)
+	}
+
+	// Nodes are kept if no node reports addresses
+	client.addNode("10.0.0.2:3306", true)
+	if result := client.removeStaleNodes([]XtradbMetrics{{Node: "localhost:3306", Err: errors.New("failed")}}); len(result) != 1 || len(client.nodes) != 4 {
+		t.Errorf("expected nodes to be kept, got %d known nodes", len(client.nodes))
+	}
+}
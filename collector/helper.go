@@ -9,6 +9,10 @@ func newGlobalMetric(namespace string, metricName string, docString string) *pro
 	return prometheus.NewDesc(namespace+"_"+metricName, docString, nil, nil)
 }
 
+func newLabeledMetric(namespace string, metricName string, docString string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(namespace+"_"+metricName, docString, labels, nil)
+}
+
 func newUpMetric(namespace string) prometheus.Gauge {
 	return prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: namespace,
@@ -16,3 +20,20 @@ func newUpMetric(namespace string) prometheus.Gauge {
 		Help:      "Status of the last metric scrape",
 	})
 }
+
+// sendStateSet sends a series for every state of states and for current state if it is not one of them.
+// Only the series of current state is set to 1. State is the last label of desc and follows labelValues.
+func sendStateSet(ch chan<- prometheus.Metric, desc *prometheus.Desc, states []string, current string, labelValues ...string) {
+	known := false
+	for _, state := range states {
+		value := 0.0
+		if state == current {
+			value = 1
+			known = true
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append(labelValues, state)...)
+	}
+	if !known {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, append(labelValues, current)...)
+	}
+}
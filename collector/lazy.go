@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LazyCollector creates a client and a collector for a service once the service becomes available.
+// Until then it reports the service as down and retries on scrapes. It implements prometheus.Collector interface.
+type LazyCollector struct {
+	service           string
+	newCollector      func(ctx context.Context) (Collector, error)
+	retryInterval     time.Duration
+	collector         Collector
+	lastError         error
+	lastAttempt       time.Time
+	upMetric          prometheus.Gauge
+	connectedMetric   prometheus.Gauge
+	attemptsMetric    prometheus.Counter
+	failuresMetric    prometheus.Counter
+	lastAttemptMetric prometheus.Gauge
+	// closed is set by Close, the collector is not created after that
+	closed bool
+	mutex  sync.Mutex
+}
+
+// NewLazyCollector creates a LazyCollector. newCollector is called to create client and collector for the service
+// within ctx, failed attempts are repeated on scrapes not more often than once per retryInterval.
+func NewLazyCollector(newCollector func(ctx context.Context) (Collector, error), namespace string, retryInterval time.Duration) *LazyCollector {
+	return &LazyCollector{
+		service:       namespace,
+		newCollector:  newCollector,
+		retryInterval: retryInterval,
+		upMetric:      newUpMetric(namespace),
+		connectedMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "client_connected",
+			Help:      "Whether the client for the service has been created",
+		}),
+		attemptsMetric: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_connection_attempts_total",
+			Help:      "Total number of attempts to create the client for the service",
+		}),
+		failuresMetric: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "client_connection_failures_total",
+			Help:      "Total number of failed attempts to create the client for the service",
+		}),
+		lastAttemptMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "client_last_connection_attempt_timestamp_seconds",
+			Help:      "Timestamp of the last attempt to create the client for the service",
+		}),
+	}
+}
+
+// Connect tries to create the client and the collector within ctx once. Failed attempt is repeated on scrapes.
+func (c *LazyCollector) Connect(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("%s collector is closed", c.service)
+	}
+	if c.collector != nil {
+		return nil
+	}
+	return c.connect(ctx)
+}
+
+func (c *LazyCollector) connect(ctx context.Context) error {
+	c.lastAttempt = time.Now()
+	c.lastAttemptMetric.Set(float64(c.lastAttempt.Unix()))
+	c.attemptsMetric.Inc()
+	collector, err := c.newCollector(ctx)
+	if err != nil {
+		c.lastError = err
+		c.failuresMetric.Inc()
+		return err
+	}
+	c.collector = collector
+	c.connectedMetric.Set(1)
+	return nil
+}
+
+// Close closes the wrapped collector if it holds resources, e.g. database connections.
+// It waits for Update in progress to finish, the collector is not created after that.
+func (c *LazyCollector) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	if closer, ok := c.collector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Describe sends no descriptors, because metrics of the wrapped collector are not known
+// until it is created. This makes LazyCollector an unchecked collector.
+func (c *LazyCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect creates the collector if it has not been created yet and sends metrics
+// of the wrapped collector to the provided channel.
+func (c *LazyCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		log.Printf("Error getting %s stats: %v", c.service, err)
+	}
+}
+
+// Update creates the collector if it has not been created yet and sends metrics
+// of the wrapped collector fetched within ctx to the provided channel.
+func (c *LazyCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("%s collector is closed", c.service)
+	}
+	if c.collector == nil && time.Since(c.lastAttempt) >= c.retryInterval {
+		// Error is kept in lastError and reported below
+		_ = c.connect(ctx)
+	}
+
+	ch <- c.connectedMetric
+	ch <- c.attemptsMetric
+	ch <- c.failuresMetric
+	ch <- c.lastAttemptMetric
+
+	if c.collector == nil {
+		c.upMetric.Set(serviceDown)
+		ch <- c.upMetric
+		return fmt.Errorf("%s Client is not created: %v", c.service, c.lastError)
+	}
+	return c.collector.Update(ctx, ch)
+}
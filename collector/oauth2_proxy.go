@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"log"
 	"sync"
 
@@ -31,17 +32,24 @@ func (c *Oauth2ProxyCollector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect fetches metrics from oauth2_proxy and sends them to the provided channel.
 func (c *Oauth2ProxyCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		log.Printf("Error getting oauth2_proxy stats: %v", err)
+	}
+}
+
+// Update fetches metrics from oauth2_proxy within ctx and sends them to the provided channel.
+func (c *Oauth2ProxyCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	err := c.oauth2ProxyClient.GetStatus()
+	err := c.oauth2ProxyClient.GetStatus(ctx)
 	if err != nil {
 		c.upMetric.Set(serviceDown)
 		ch <- c.upMetric
-		log.Printf("Error getting oauth2_proxy stats: %v", err)
-		return
+		return err
 	}
 
 	c.upMetric.Set(serviceUp)
 	ch <- c.upMetric
+	return nil
 }
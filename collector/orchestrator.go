@@ -1,13 +1,19 @@
 package collector
 
 import (
+	"context"
 	"log"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/MaxFedotov/orcus-exporter/client"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// raftStates are possible states of Orchestrator raft node
+var raftStates = []string{"Leader", "Follower", "Candidate", "Shutdown"}
+
 // OrchestratorCollector collects Orchestrator metrics. It implements prometheus.Collector interface.
 type OrchestratorCollector struct {
 	orchestratorClient *client.OrchestratorClient
@@ -23,10 +29,80 @@ func NewOrchestratorCollector(orchestratorClient *client.OrchestratorClient, nam
 		metrics: map[string]*prometheus.Desc{
 			"cluter_size":      newGlobalMetric(namespace, "cluter_size", "Number of nodes in Orchestrator cluster"),
 			"is_active_node":   newGlobalMetric(namespace, "is_active_node", "If this node is active Orchestrator node"),
-			"problems":         newGlobalMetric(namespace, "problems", "Count of MySQL clusters with problems"),
 			"last_failover_id": newGlobalMetric(namespace, "last_failover_id", "ID of last failover"),
 			"is_healthy":       newGlobalMetric(namespace, "is_healthy", "Orchestrator node health status"),
 			"failed_seeds":     newGlobalMetric(namespace, "failed_seeds", "Number of failed seeds"),
+			"raft_enabled":     newGlobalMetric(namespace, "raft_enabled", "If Orchestrator runs in raft mode"),
+			"raft_healthy":     newGlobalMetric(namespace, "raft_healthy", "If Orchestrator node is a part of a healthy raft group"),
+			"raft_state": newLabeledMetric(namespace, "raft_state",
+				"Raft state of Orchestrator node", "state"),
+			"raft_leader": newLabeledMetric(namespace, "raft_leader",
+				"Raft leader as seen by Orchestrator node", "leader"),
+			"raft_peer_healthy": newLabeledMetric(namespace, "raft_peer_healthy",
+				"If raft peer is healthy", "peer"),
+			"downtime_end_timestamp_seconds": newLabeledMetric(namespace, "downtime_end_timestamp_seconds",
+				"End time of MySQL instance downtime", "cluster", "hostname", "port", "owner", "reason"),
+			"maintenance_age_seconds": newLabeledMetric(namespace, "maintenance_age_seconds",
+				"Time elapsed since MySQL instance maintenance has begun", "maintenance_id", "hostname", "port", "owner", "reason"),
+			"global_recoveries_enabled": newGlobalMetric(namespace, "global_recoveries_enabled", "If recoveries are enabled globally"),
+			"blocked_recoveries": newLabeledMetric(namespace, "blocked_recoveries",
+				"Number of recoveries blocked by recent recoveries of MySQL cluster", "cluster", "analysis"),
+			"cluster_active_recoveries": newLabeledMetric(namespace, "cluster_active_recoveries",
+				"Number of recoveries of MySQL cluster in progress", "cluster"),
+			"cluster_unacknowledged_recoveries": newLabeledMetric(namespace, "cluster_unacknowledged_recoveries",
+				"Number of recent recoveries of MySQL cluster which are not acknowledged", "cluster"),
+			"agents": newGlobalMetric(namespace, "agents", "Number of registered orchestrator-agents"),
+			"agent_last_seen_age_seconds": newLabeledMetric(namespace, "agent_last_seen_age_seconds",
+				"Time elapsed since orchestrator-agent has submitted its data last time", "hostname"),
+			"agent_active_seed_stage": newLabeledMetric(namespace, "agent_active_seed_stage",
+				"Current stage of seed operation in progress", "hostname", "source_hostname", "seed_id", "stage"),
+			"agent_active_seed_stages": newLabeledMetric(namespace, "agent_active_seed_stages",
+				"Number of stages seed operation in progress has passed", "hostname", "source_hostname", "seed_id"),
+			"agent_active_seed_elapsed_seconds": newLabeledMetric(namespace, "agent_active_seed_elapsed_seconds",
+				"Time elapsed since seed operation in progress has started", "hostname", "source_hostname", "seed_id"),
+			"agent_failed_seeds": newLabeledMetric(namespace, "agent_failed_seeds",
+				"Number of failed seeds of orchestrator-agent", "hostname"),
+			"problems": newLabeledMetric(namespace, "problems",
+				"Number of MySQL instances with problem of the type", "cluster", "problem_type"),
+			"recoveries_total": newLabeledMetric(namespace, "recoveries_total",
+				"Total number of recoveries finished since the exporter has started", "cluster", "analysis", "successful"),
+			"last_recovery_timestamp_seconds": newLabeledMetric(namespace, "last_recovery_timestamp_seconds",
+				"Start time of the last finished recovery of MySQL cluster", "cluster"),
+			"last_recovery_duration_seconds": newLabeledMetric(namespace, "last_recovery_duration_seconds",
+				"Duration of the last finished recovery of MySQL cluster", "cluster"),
+			"cluster_instances": newLabeledMetric(namespace, "cluster_instances",
+				"Number of instances in MySQL cluster", "cluster", "alias"),
+			"cluster_problem_instances": newLabeledMetric(namespace, "cluster_problem_instances",
+				"Number of instances with problems in MySQL cluster", "cluster", "alias"),
+			"cluster_heuristic_lag_seconds": newLabeledMetric(namespace, "cluster_heuristic_lag_seconds",
+				"Heuristic replication lag of MySQL cluster", "cluster", "alias"),
+			"cluster_automated_master_recovery": newLabeledMetric(namespace, "cluster_automated_master_recovery",
+				"If automated master recovery is enabled for MySQL cluster", "cluster", "alias"),
+			"cluster_automated_intermediate_master_recovery": newLabeledMetric(namespace, "cluster_automated_intermediate_master_recovery",
+				"If automated intermediate master recovery is enabled for MySQL cluster", "cluster", "alias"),
+			"instance_seconds_behind_master": newLabeledMetric(namespace, "instance_seconds_behind_master",
+				"Seconds behind master reported by MySQL instance", "cluster", "hostname", "port"),
+			"instance_replication_lag_seconds": newLabeledMetric(namespace, "instance_replication_lag_seconds",
+				"Replication lag of MySQL instance measured by Orchestrator", "cluster", "hostname", "port"),
+			"instance_replication_sql_thread_running": newLabeledMetric(namespace, "instance_replication_sql_thread_running",
+				"If replication SQL thread is running on MySQL instance", "cluster", "hostname", "port"),
+			"instance_replication_io_thread_running": newLabeledMetric(namespace, "instance_replication_io_thread_running",
+				"If replication IO thread is running on MySQL instance", "cluster", "hostname", "port"),
+			"instance_read_only": newLabeledMetric(namespace, "instance_read_only",
+				"If MySQL instance is read only", "cluster", "hostname", "port"),
+			"instance_is_last_check_valid": newLabeledMetric(namespace, "instance_is_last_check_valid",
+				"If last check of MySQL instance by Orchestrator was valid", "cluster", "hostname", "port"),
+			"instance_is_downtimed": newLabeledMetric(namespace, "instance_is_downtimed",
+				"If MySQL instance is downtimed", "cluster", "hostname", "port"),
+			"active_nodes": newGlobalMetric(namespace, "active_nodes", "Number of Orchestrator nodes which report themselves as active"),
+			"node_up": newLabeledMetric(namespace, "node_up",
+				"If Orchestrator node API is reachable", "node"),
+			"node_healthy": newLabeledMetric(namespace, "node_healthy",
+				"Orchestrator node health status", "node"),
+			"node_is_active": newLabeledMetric(namespace, "node_is_active",
+				"If Orchestrator node is active", "node"),
+			"node_is_raft_leader": newLabeledMetric(namespace, "node_is_raft_leader",
+				"If Orchestrator node is raft leader", "node"),
 		},
 		upMetric: newUpMetric(namespace),
 	}
@@ -51,30 +127,215 @@ func boolToFloat64(val bool) float64 {
 
 // Collect fetches metrics from Orchestrator and sends them to the provided channel.
 func (c *OrchestratorCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		log.Printf("Error getting Orchestrator stats: %v", err)
+	}
+}
+
+// Update fetches metrics from Orchestrator within ctx and sends them to the provided channel.
+func (c *OrchestratorCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	c.mutex.Lock() // To protect metrics from concurrent collects
 	defer c.mutex.Unlock()
 
-	stats, err := c.orchestratorClient.GetMetrics()
+	stats, err := c.orchestratorClient.GetMetrics(ctx)
 	if err != nil {
 		c.upMetric.Set(serviceDown)
 		ch <- c.upMetric
-		log.Printf("Error getting Orchestrator stats: %v", err)
-		return
+		return err
 	}
 
 	c.upMetric.Set(serviceUp)
 	ch <- c.upMetric
+	for _, err := range stats.Errors {
+		log.Printf("Error getting Orchestrator stats: %v", err)
+	}
 
-	ch <- prometheus.MustNewConstMetric(c.metrics["cluter_size"],
-		prometheus.GaugeValue, float64(len(stats.Status.Details.AvailableNodes)))
-	ch <- prometheus.MustNewConstMetric(c.metrics["is_active_node"],
-		prometheus.GaugeValue, boolToFloat64(stats.Status.Details.IsActiveNode))
-	ch <- prometheus.MustNewConstMetric(c.metrics["problems"],
-		prometheus.GaugeValue, float64(len(stats.Problems)))
+	if stats.Status != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluter_size"],
+			prometheus.GaugeValue, float64(len(stats.Status.Details.AvailableNodes)))
+		ch <- prometheus.MustNewConstMetric(c.metrics["is_active_node"],
+			prometheus.GaugeValue, boolToFloat64(stats.Status.Details.IsActiveNode))
+		ch <- prometheus.MustNewConstMetric(c.metrics["is_healthy"],
+			prometheus.GaugeValue, boolToFloat64(stats.Status.Details.Healthy))
+	} else {
+		// The configured node is unreachable, so it is neither healthy nor active
+		ch <- prometheus.MustNewConstMetric(c.metrics["is_active_node"], prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(c.metrics["is_healthy"], prometheus.GaugeValue, 0)
+	}
 	ch <- prometheus.MustNewConstMetric(c.metrics["last_failover_id"],
 		prometheus.CounterValue, float64(stats.LastFailoverID))
-	ch <- prometheus.MustNewConstMetric(c.metrics["is_healthy"],
-		prometheus.GaugeValue, boolToFloat64(stats.Status.Details.Healthy))
 	ch <- prometheus.MustNewConstMetric(c.metrics["failed_seeds"],
-		prometheus.CounterValue, float64(stats.FailedSeeds))
+		prometheus.GaugeValue, float64(len(stats.FailedSeeds)))
+
+	activeNodes := 0
+	for _, node := range stats.Nodes {
+		if node.IsActiveNode {
+			activeNodes++
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics["node_up"],
+			prometheus.GaugeValue, boolToFloat64(node.Up), node.Node)
+		if !node.Up {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics["node_healthy"],
+			prometheus.GaugeValue, boolToFloat64(node.Healthy), node.Node)
+		ch <- prometheus.MustNewConstMetric(c.metrics["node_is_active"],
+			prometheus.GaugeValue, boolToFloat64(node.IsActiveNode), node.Node)
+		ch <- prometheus.MustNewConstMetric(c.metrics["node_is_raft_leader"],
+			prometheus.GaugeValue, boolToFloat64(node.IsRaftLeader), node.Node)
+	}
+	ch <- prometheus.MustNewConstMetric(c.metrics["active_nodes"],
+		prometheus.GaugeValue, float64(activeNodes))
+
+	if stats.Agents != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics["agents"],
+			prometheus.GaugeValue, float64(len(stats.Agents.Agents)))
+		for _, agent := range stats.Agents.Agents {
+			if agent.LastSeen.IsZero() {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.metrics["agent_last_seen_age_seconds"],
+				prometheus.GaugeValue, time.Since(agent.LastSeen).Seconds(), agent.Hostname)
+		}
+		for _, seed := range stats.Agents.ActiveSeeds {
+			labels := []string{seed.TargetHostname, seed.SourceHostname, strconv.FormatInt(seed.SeedID, 10)}
+			ch <- prometheus.MustNewConstMetric(c.metrics["agent_active_seed_stage"],
+				prometheus.GaugeValue, 1, append(labels, seed.Stage)...)
+			ch <- prometheus.MustNewConstMetric(c.metrics["agent_active_seed_stages"],
+				prometheus.GaugeValue, float64(seed.Stages), labels...)
+			if !seed.Start.IsZero() {
+				ch <- prometheus.MustNewConstMetric(c.metrics["agent_active_seed_elapsed_seconds"],
+					prometheus.GaugeValue, time.Since(seed.Start).Seconds(), labels...)
+			}
+		}
+	}
+	failedSeeds := make(map[string]int)
+	for _, seed := range stats.FailedSeeds {
+		failedSeeds[seed.TargetHostname]++
+	}
+	for hostname, count := range failedSeeds {
+		ch <- prometheus.MustNewConstMetric(c.metrics["agent_failed_seeds"],
+			prometheus.GaugeValue, float64(count), hostname)
+	}
+
+	if stats.Raft != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics["raft_enabled"],
+			prometheus.GaugeValue, boolToFloat64(stats.Raft.Enabled))
+	}
+	if stats.Raft != nil && stats.Raft.Enabled {
+		ch <- prometheus.MustNewConstMetric(c.metrics["raft_healthy"],
+			prometheus.GaugeValue, boolToFloat64(stats.Raft.Healthy))
+		for _, state := range raftStates {
+			ch <- prometheus.MustNewConstMetric(c.metrics["raft_state"],
+				prometheus.GaugeValue, boolToFloat64(stats.Raft.State == state), state)
+		}
+		if stats.Raft.Leader != "" {
+			ch <- prometheus.MustNewConstMetric(c.metrics["raft_leader"],
+				prometheus.GaugeValue, 1, stats.Raft.Leader)
+		}
+		for peer, healthy := range stats.Raft.Peers {
+			ch <- prometheus.MustNewConstMetric(c.metrics["raft_peer_healthy"],
+				prometheus.GaugeValue, boolToFloat64(healthy), peer)
+		}
+	}
+
+	if stats.GlobalRecoveries != nil {
+		ch <- prometheus.MustNewConstMetric(c.metrics["global_recoveries_enabled"],
+			prometheus.GaugeValue, boolToFloat64(*stats.GlobalRecoveries))
+	}
+	type blockedKey struct {
+		cluster  string
+		analysis string
+	}
+	blocked := make(map[blockedKey]int)
+	for _, recovery := range stats.BlockedRecoveries {
+		blocked[blockedKey{recovery.ClusterName, recovery.Analysis}]++
+	}
+	for key, count := range blocked {
+		ch <- prometheus.MustNewConstMetric(c.metrics["blocked_recoveries"],
+			prometheus.GaugeValue, float64(count), key.cluster, key.analysis)
+	}
+	for cluster, recoveries := range stats.ClusterRecoveries {
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_active_recoveries"],
+			prometheus.GaugeValue, float64(recoveries.Active), cluster)
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_unacknowledged_recoveries"],
+			prometheus.GaugeValue, float64(recoveries.Unacknowledged), cluster)
+	}
+
+	for _, downtime := range stats.Downtimes {
+		ch <- prometheus.MustNewConstMetric(c.metrics["downtime_end_timestamp_seconds"],
+			prometheus.GaugeValue, float64(downtime.End.Unix()), downtime.ClusterName, downtime.Key.Hostname,
+			strconv.Itoa(downtime.Key.Port), downtime.Owner, downtime.Reason)
+	}
+	for _, maintenance := range stats.Maintenance {
+		if !maintenance.IsActive {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics["maintenance_age_seconds"],
+			prometheus.GaugeValue, float64(maintenance.SecondsElapsed), strconv.FormatInt(maintenance.MaintenanceID, 10), maintenance.Key.Hostname,
+			strconv.Itoa(maintenance.Key.Port), maintenance.Owner, maintenance.Reason)
+	}
+
+	for key, total := range stats.Recoveries.Total {
+		ch <- prometheus.MustNewConstMetric(c.metrics["recoveries_total"],
+			prometheus.CounterValue, float64(total), key.ClusterName, key.Analysis, strconv.FormatBool(key.Successful))
+	}
+	for cluster, recovery := range stats.Recoveries.Last {
+		ch <- prometheus.MustNewConstMetric(c.metrics["last_recovery_timestamp_seconds"],
+			prometheus.GaugeValue, float64(recovery.Start.Unix()), cluster)
+		ch <- prometheus.MustNewConstMetric(c.metrics["last_recovery_duration_seconds"],
+			prometheus.GaugeValue, recovery.End.Sub(recovery.Start).Seconds(), cluster)
+	}
+
+	type problemKey struct {
+		cluster     string
+		problemType string
+	}
+	problems := make(map[problemKey]int)
+	problemInstances := make(map[string]int)
+	for _, problem := range stats.Problems {
+		problemInstances[problem.ClusterName]++
+		for _, problemType := range problem.ProblemTypes() {
+			problems[problemKey{problem.ClusterName, problemType}]++
+		}
+	}
+	for key, count := range problems {
+		ch <- prometheus.MustNewConstMetric(c.metrics["problems"],
+			prometheus.GaugeValue, float64(count), key.cluster, key.problemType)
+	}
+	for _, cluster := range stats.Clusters {
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_instances"],
+			prometheus.GaugeValue, float64(cluster.CountInstances), cluster.ClusterName, cluster.ClusterAlias)
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_problem_instances"],
+			prometheus.GaugeValue, float64(problemInstances[cluster.ClusterName]), cluster.ClusterName, cluster.ClusterAlias)
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_heuristic_lag_seconds"],
+			prometheus.GaugeValue, float64(cluster.HeuristicLag), cluster.ClusterName, cluster.ClusterAlias)
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_automated_master_recovery"],
+			prometheus.GaugeValue, boolToFloat64(cluster.HasAutomatedMasterRecovery), cluster.ClusterName, cluster.ClusterAlias)
+		ch <- prometheus.MustNewConstMetric(c.metrics["cluster_automated_intermediate_master_recovery"],
+			prometheus.GaugeValue, boolToFloat64(cluster.HasAutomatedIntermediateMasterRecovery), cluster.ClusterName, cluster.ClusterAlias)
+	}
+
+	for _, instance := range stats.Instances {
+		labels := []string{instance.ClusterName, instance.Key.Hostname, strconv.Itoa(instance.Key.Port)}
+		if instance.SecondsBehindMaster.Valid {
+			ch <- prometheus.MustNewConstMetric(c.metrics["instance_seconds_behind_master"],
+				prometheus.GaugeValue, float64(instance.SecondsBehindMaster.Int64), labels...)
+		}
+		if instance.ReplicationLagSeconds.Valid {
+			ch <- prometheus.MustNewConstMetric(c.metrics["instance_replication_lag_seconds"],
+				prometheus.GaugeValue, float64(instance.ReplicationLagSeconds.Int64), labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_replication_sql_thread_running"],
+			prometheus.GaugeValue, boolToFloat64(instance.ReplicationSQLThreadRuning), labels...)
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_replication_io_thread_running"],
+			prometheus.GaugeValue, boolToFloat64(instance.ReplicationIOThreadRuning), labels...)
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_read_only"],
+			prometheus.GaugeValue, boolToFloat64(instance.ReadOnly), labels...)
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_is_last_check_valid"],
+			prometheus.GaugeValue, boolToFloat64(instance.IsLastCheckValid), labels...)
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_is_downtimed"],
+			prometheus.GaugeValue, boolToFloat64(instance.IsDowntimed), labels...)
+	}
+	return nil
 }
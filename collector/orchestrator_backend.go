@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/MaxFedotov/orcus-exporter/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OrchestratorBackendCollector collects Orchestrator backend database metrics. It implements prometheus.Collector interface.
+type OrchestratorBackendCollector struct {
+	backendClient *client.OrchestratorBackendClient
+	metrics       map[string]*prometheus.Desc
+	upMetric      prometheus.Gauge
+	mutex         sync.Mutex
+}
+
+// NewOrchestratorBackendCollector creates an OrchestratorBackendCollector.
+func NewOrchestratorBackendCollector(backendClient *client.OrchestratorBackendClient, namespace string) *OrchestratorBackendCollector {
+	return &OrchestratorBackendCollector{
+		backendClient: backendClient,
+		metrics: map[string]*prometheus.Desc{
+			"instances": newGlobalMetric(namespace, "instances", "Number of MySQL instances known to Orchestrator"),
+			"instance_last_checked_age_seconds": newGlobalMetric(namespace, "instance_last_checked_age_seconds",
+				"Time elapsed since the most recent check of any MySQL instance by Orchestrator"),
+			"instance_last_seen_age_seconds": newGlobalMetric(namespace, "instance_last_seen_age_seconds",
+				"Time elapsed since any MySQL instance was successfully checked by Orchestrator last time"),
+			"instances_not_recently_checked": newGlobalMetric(namespace, "instances_not_recently_checked",
+				"Number of MySQL instances not checked by Orchestrator within poll interval"),
+			"node_health_nodes": newGlobalMetric(namespace, "node_health_nodes",
+				"Number of Orchestrator nodes registered in node_health table"),
+			"node_last_seen_active_age_seconds": newLabeledMetric(namespace, "node_last_seen_active_age_seconds",
+				"Time elapsed since Orchestrator node was seen active last time", "hostname"),
+			"audit_table_rows": newLabeledMetric(namespace, "audit_table_rows",
+				"Estimated number of rows in Orchestrator audit table", "table"),
+			"audit_table_size_bytes": newLabeledMetric(namespace, "audit_table_size_bytes",
+				"Size of data and indexes of Orchestrator audit table", "table"),
+		},
+		upMetric: newUpMetric(namespace),
+	}
+}
+
+// Close closes connection of the client to Orchestrator backend database.
+func (c *OrchestratorBackendCollector) Close() error {
+	return c.backendClient.Close()
+}
+
+// Describe sends the super-set of all possible descriptors of Orchestrator backend metrics
+// to the provided channel.
+func (c *OrchestratorBackendCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.upMetric.Desc()
+
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
+
+// Collect fetches metrics from Orchestrator backend database and sends them to the provided channel.
+func (c *OrchestratorBackendCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		log.Printf("Error getting Orchestrator backend stats: %v", err)
+	}
+}
+
+// Update fetches metrics from Orchestrator backend database within ctx and sends them to the provided channel.
+func (c *OrchestratorBackendCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock() // To protect metrics from concurrent collects
+	defer c.mutex.Unlock()
+
+	stats, err := c.backendClient.GetMetrics(ctx)
+	if err != nil {
+		c.upMetric.Set(serviceDown)
+		ch <- c.upMetric
+		return err
+	}
+
+	c.upMetric.Set(serviceUp)
+	ch <- c.upMetric
+
+	ch <- prometheus.MustNewConstMetric(c.metrics["instances"],
+		prometheus.GaugeValue, float64(stats.Instances))
+	if stats.LastCheckedAge.Valid {
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_last_checked_age_seconds"],
+			prometheus.GaugeValue, float64(stats.LastCheckedAge.Int64))
+	}
+	if stats.LastSeenAge.Valid {
+		ch <- prometheus.MustNewConstMetric(c.metrics["instance_last_seen_age_seconds"],
+			prometheus.GaugeValue, float64(stats.LastSeenAge.Int64))
+	}
+	ch <- prometheus.MustNewConstMetric(c.metrics["instances_not_recently_checked"],
+		prometheus.GaugeValue, float64(stats.NotRecentlyChecked))
+	ch <- prometheus.MustNewConstMetric(c.metrics["node_health_nodes"],
+		prometheus.GaugeValue, float64(len(stats.NodeHealth)))
+	for hostname, age := range stats.NodeHealth {
+		ch <- prometheus.MustNewConstMetric(c.metrics["node_last_seen_active_age_seconds"],
+			prometheus.GaugeValue, float64(age), hostname)
+	}
+	for _, table := range stats.AuditTables {
+		ch <- prometheus.MustNewConstMetric(c.metrics["audit_table_rows"],
+			prometheus.GaugeValue, float64(table.Rows), table.Name)
+		ch <- prometheus.MustNewConstMetric(c.metrics["audit_table_size_bytes"],
+			prometheus.GaugeValue, float64(table.Size), table.Name)
+	}
+	return nil
+}
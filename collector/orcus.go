@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"log"
 	"sync"
 
@@ -42,15 +43,21 @@ func (c *OrcusCollector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect fetches metrics from Orcus and sends them to the provided channel.
 func (c *OrcusCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		log.Printf("Error getting Orcus stats: %v", err)
+	}
+}
+
+// Update fetches metrics from Orcus within ctx and sends them to the provided channel.
+func (c *OrcusCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	c.mutex.Lock() // To protect metrics from concurrent collects
 	defer c.mutex.Unlock()
 
-	stats, err := c.orcusClient.GetMetrics()
+	stats, err := c.orcusClient.GetMetrics(ctx)
 	if err != nil {
 		c.upMetric.Set(serviceDown)
 		ch <- c.upMetric
-		log.Printf("Error getting Orcus stats: %v", err)
-		return
+		return err
 	}
 
 	c.upMetric.Set(serviceUp)
@@ -64,4 +71,5 @@ func (c *OrcusCollector) Collect(ch chan<- prometheus.Metric) {
 		prometheus.GaugeValue, float64(stats.LastSyncDurationSeconds))
 	ch <- prometheus.MustNewConstMetric(c.metrics["sync_count_total"],
 		prometheus.CounterValue, float64(stats.TotalSyncCount))
+	return nil
 }
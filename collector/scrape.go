@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a collector which stops collecting when ctx is done and reports
+// whether the collection succeeded.
+type Collector interface {
+	// Describe sends the super-set of all possible descriptors of metrics
+	// to the provided channel.
+	Describe(ch chan<- *prometheus.Desc)
+	// Update fetches metrics within ctx and sends them to the provided channel.
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
+}
+
+// PrometheusCollector adapts a prometheus.Collector which is not aware of context to Collector interface.
+type PrometheusCollector struct {
+	collector prometheus.Collector
+}
+
+// NewPrometheusCollector creates a PrometheusCollector.
+func NewPrometheusCollector(collector prometheus.Collector) *PrometheusCollector {
+	return &PrometheusCollector{
+		collector: collector,
+	}
+}
+
+// Describe sends descriptors of the wrapped collector to the provided channel.
+func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+// Update collects metrics of the wrapped collector and sends them to the provided channel
+// until ctx is done. Metrics collected after that are dropped.
+func (c *PrometheusCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		c.collector.Collect(metrics)
+		close(metrics)
+	}()
+	for {
+		select {
+		case m, ok := <-metrics:
+			if !ok {
+				return nil
+			}
+			ch <- m
+		case <-ctx.Done():
+			go func() {
+				for range metrics {
+				}
+			}()
+			return ctx.Err()
+		}
+	}
+}
+
+// ScrapeCollector runs collectors concurrently, each of them with its own deadline,
+// and reports duration and result of their scrapes. It implements prometheus.Collector interface.
+type ScrapeCollector struct {
+	collectors   map[string]scrapeTarget
+	durationDesc *prometheus.Desc
+	successDesc  *prometheus.Desc
+}
+
+type scrapeTarget struct {
+	collector Collector
+	timeout   time.Duration
+}
+
+// NewScrapeCollector creates a ScrapeCollector.
+func NewScrapeCollector(namespace string) *ScrapeCollector {
+	return &ScrapeCollector{
+		collectors: make(map[string]scrapeTarget),
+		durationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
+			"Duration of a collector scrape",
+			[]string{"collector"}, nil,
+		),
+		successDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "collector_success"),
+			"Whether a collector succeeded",
+			[]string{"collector"}, nil,
+		),
+	}
+}
+
+// Add adds collector with the given name which has timeout to finish its scrape.
+func (c *ScrapeCollector) Add(name string, collector Collector, timeout time.Duration) {
+	c.collectors[name] = scrapeTarget{
+		collector: collector,
+		timeout:   timeout,
+	}
+}
+
+// Close closes collectors which hold resources, e.g. database connections.
+func (c *ScrapeCollector) Close() error {
+	var err error
+	for name, target := range c.collectors {
+		closer, ok := target.collector.(io.Closer)
+		if !ok {
+			continue
+		}
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close %s collector: %v", name, closeErr)
+		}
+	}
+	return err
+}
+
+// Describe sends no descriptors, because collectors created lazily are not able to
+// describe their metrics. This makes ScrapeCollector an unchecked collector.
+func (c *ScrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect runs all collectors concurrently and sends their metrics to the provided channel.
+func (c *ScrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	wg.Add(len(c.collectors))
+	for name, target := range c.collectors {
+		go func(name string, target scrapeTarget) {
+			defer wg.Done()
+			c.scrape(name, target, ch)
+		}(name, target)
+	}
+	wg.Wait()
+}
+
+func (c *ScrapeCollector) scrape(name string, target scrapeTarget, ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), target.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := target.collector.Update(ctx, ch)
+	duration := time.Since(start)
+
+	success := 1.0
+	if err != nil {
+		log.Printf("Error collecting %s metrics: %v", name, err)
+		success = 0
+	}
+	ch <- prometheus.MustNewConstMetric(c.durationDesc, prometheus.GaugeValue, duration.Seconds(), name)
+	ch <- prometheus.MustNewConstMetric(c.successDesc, prometheus.GaugeValue, success, name)
+}
@@ -1,13 +1,21 @@
 package collector
 
 import (
+	"context"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/MaxFedotov/orcus-exporter/client"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// xtradbNodeStates are possible states of Xtradb cluster node
+var xtradbNodeStates = []string{"Initialized", "Joining", "Donor/Desynced", "Joined", "Synced"}
+
+// xtradbClusterStatuses are possible statuses of Xtradb cluster component as reported by Galera
+var xtradbClusterStatuses = []string{"Primary", "non-Primary", "Disconnected"}
+
 // XtradbCollector collects Xtradb cluster metrics. It implements prometheus.Collector interface.
 type XtradbCollector struct {
 	xtradbClient *client.XtradbClient
@@ -21,14 +29,96 @@ func NewXtradbCollector(xtradbClient *client.XtradbClient, namespace string) *Xt
 	return &XtradbCollector{
 		xtradbClient: xtradbClient,
 		metrics: map[string]*prometheus.Desc{
-			"cluter_size":    newGlobalMetric(namespace, "cluter_size", "Number of nodes in Xtradb cluster"),
-			"node_state":     newGlobalMetric(namespace, "node_state", "State code of Xtradb cluster node"),
-			"cluster_status": newGlobalMetric(namespace, "cluster_status", "State code of Xtradb cluster status"),
+			"cluter_size": newLabeledMetric(namespace, "cluter_size",
+				"Number of nodes in Xtradb cluster", "node"),
+			"node_state": newLabeledMetric(namespace, "node_state",
+				"State of Xtradb cluster node", "node", "state"),
+			"cluster_status": newLabeledMetric(namespace, "cluster_status",
+				"Status of Xtradb cluster component the node belongs to", "node", "status"),
+			"node_up": newLabeledMetric(namespace, "node_up",
+				"If Xtradb cluster node is reachable", "node"),
+			"state_uuids": newGlobalMetric(namespace, "state_uuids",
+				"Number of distinct cluster state UUIDs reported by reachable nodes"),
+			"conf_ids": newGlobalMetric(namespace, "conf_ids",
+				"Number of distinct cluster configuration IDs reported by reachable nodes"),
+			"consistent": newGlobalMetric(namespace, "consistent",
+				"If all reachable nodes belong to Primary component and report the same cluster state UUID and configuration ID"),
+			"flow_control_paused_ratio": newLabeledMetric(namespace, "flow_control_paused_ratio",
+				"Fraction of time replication was paused by flow control since the last FLUSH STATUS", "node"),
+			"flow_control_sent_total": newLabeledMetric(namespace, "flow_control_sent_total",
+				"Number of flow control pause events sent by Xtradb cluster node", "node"),
+			"flow_control_recv_total": newLabeledMetric(namespace, "flow_control_recv_total",
+				"Number of flow control pause events received by Xtradb cluster node", "node"),
+			"local_send_queue_avg": newLabeledMetric(namespace, "local_send_queue_avg",
+				"Average length of send queue since the last FLUSH STATUS", "node"),
+			"local_recv_queue_avg": newLabeledMetric(namespace, "local_recv_queue_avg",
+				"Average length of receive queue since the last FLUSH STATUS", "node"),
+			"local_cert_failures_total": newLabeledMetric(namespace, "local_cert_failures_total",
+				"Number of local transactions failed certification", "node"),
+			"local_bf_aborts_total": newLabeledMetric(namespace, "local_bf_aborts_total",
+				"Number of local transactions aborted by replicated transactions", "node"),
+			"replicated_bytes_total": newLabeledMetric(namespace, "replicated_bytes_total",
+				"Bytes of write sets replicated to other nodes", "node"),
+			"received_bytes_total": newLabeledMetric(namespace, "received_bytes_total",
+				"Bytes of write sets received from other nodes", "node"),
+			"ready": newLabeledMetric(namespace, "ready",
+				"If Xtradb cluster node accepts queries", "node"),
+			"connected": newLabeledMetric(namespace, "connected",
+				"If Xtradb cluster node is connected to the cluster", "node"),
+			"evs_state": newLabeledMetric(namespace, "evs_state",
+				"Extended virtual synchrony state of Xtradb cluster node", "node", "state"),
+			"last_committed": newLabeledMetric(namespace, "last_committed",
+				"Sequence number of the last committed transaction", "node"),
+			"local_cached_downto": newLabeledMetric(namespace, "local_cached_downto",
+				"The lowest sequence number in gcache of Xtradb cluster node", "node"),
+			"state_transfer_in_progress": newLabeledMetric(namespace, "state_transfer_in_progress",
+				"If Xtradb cluster node donates or receives state", "node"),
+			"state_transfer_start_timestamp_seconds": newLabeledMetric(namespace, "state_transfer_start_timestamp_seconds",
+				"Time the exporter has detected state transfer in progress", "node", "role", "method", "peer"),
+			"state_transfer_elapsed_seconds": newLabeledMetric(namespace, "state_transfer_elapsed_seconds",
+				"Time elapsed since the exporter has detected state transfer in progress", "node", "role", "method", "peer"),
+			"ist_seqno_start": newLabeledMetric(namespace, "ist_seqno_start",
+				"The first sequence number of IST received by Xtradb cluster node", "node"),
+			"ist_seqno_current": newLabeledMetric(namespace, "ist_seqno_current",
+				"The last sequence number of IST received by Xtradb cluster node", "node"),
+			"ist_seqno_end": newLabeledMetric(namespace, "ist_seqno_end",
+				"Target sequence number of IST received by Xtradb cluster node", "node"),
+			"ist_progress_ratio": newLabeledMetric(namespace, "ist_progress_ratio",
+				"Fraction of IST received by Xtradb cluster node", "node"),
+			"server_uptime_seconds": newLabeledMetric(namespace, "server_uptime_seconds",
+				"Time elapsed since MySQL server has started", "node"),
+			"server_threads_connected": newLabeledMetric(namespace, "server_threads_connected",
+				"Number of open connections", "node"),
+			"server_threads_running": newLabeledMetric(namespace, "server_threads_running",
+				"Number of threads which are not sleeping", "node"),
+			"server_max_connections": newLabeledMetric(namespace, "server_max_connections",
+				"Maximum number of connections allowed by MySQL server", "node"),
+			"server_connections_headroom": newLabeledMetric(namespace, "server_connections_headroom",
+				"Number of connections which can be opened until max_connections is reached", "node"),
+			"server_aborted_connects_total": newLabeledMetric(namespace, "server_aborted_connects_total",
+				"Number of failed attempts to connect to MySQL server", "node"),
+			"server_innodb_buffer_pool_hit_ratio": newLabeledMetric(namespace, "server_innodb_buffer_pool_hit_ratio",
+				"Fraction of logical reads served from InnoDB buffer pool since MySQL server has started", "node"),
+			"server_innodb_buffer_pool_read_requests_total": newLabeledMetric(namespace, "server_innodb_buffer_pool_read_requests_total",
+				"Number of logical reads from InnoDB buffer pool", "node"),
+			"server_innodb_buffer_pool_reads_total": newLabeledMetric(namespace, "server_innodb_buffer_pool_reads_total",
+				"Number of logical reads which InnoDB could not serve from buffer pool", "node"),
+			"server_innodb_row_lock_waits_total": newLabeledMetric(namespace, "server_innodb_row_lock_waits_total",
+				"Number of times operations on InnoDB tables had to wait for a row lock", "node"),
+			"server_innodb_row_lock_time_seconds_total": newLabeledMetric(namespace, "server_innodb_row_lock_time_seconds_total",
+				"Total time spent in acquiring row locks for InnoDB tables", "node"),
+			"server_innodb_deadlocks_total": newLabeledMetric(namespace, "server_innodb_deadlocks_total",
+				"Number of InnoDB deadlocks", "node"),
 		},
 		upMetric: newUpMetric(namespace),
 	}
 }
 
+// Close closes connections of the client to Xtradb cluster nodes.
+func (c *XtradbCollector) Close() error {
+	return c.xtradbClient.Close()
+}
+
 // Describe sends the super-set of all possible descriptors of Xtradb cluster metrics
 // to the provided channel.
 func (c *XtradbCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -41,24 +131,162 @@ func (c *XtradbCollector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect fetches metrics from Xtradb cluster and sends them to the provided channel.
 func (c *XtradbCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(context.Background(), ch); err != nil {
+		log.Printf("Error getting Xtradb cluster stats: %v", err)
+	}
+}
+
+// Update fetches metrics from Xtradb cluster within ctx and sends them to the provided channel.
+func (c *XtradbCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	c.mutex.Lock() // To protect metrics from concurrent collects
 	defer c.mutex.Unlock()
 
-	stats, err := c.xtradbClient.GetMetrics()
+	stats, err := c.xtradbClient.GetMetrics(ctx)
 	if err != nil {
 		c.upMetric.Set(serviceDown)
 		ch <- c.upMetric
-		log.Printf("Error getting Xtradb cluster stats: %v", err)
-		return
+		return err
 	}
 
 	c.upMetric.Set(serviceUp)
 	ch <- c.upMetric
 
+	for _, node := range stats.Nodes {
+		if node.Err != nil {
+			log.Printf("Error getting Xtradb cluster node %s stats: %v", node.Node, node.Err)
+		}
+		c.sendNodeMetrics(ch, node)
+	}
+	stateUUIDs, confIDs, consistent := xtradbConsistency(stats.Nodes)
+	ch <- prometheus.MustNewConstMetric(c.metrics["state_uuids"],
+		prometheus.GaugeValue, float64(stateUUIDs))
+	ch <- prometheus.MustNewConstMetric(c.metrics["conf_ids"],
+		prometheus.GaugeValue, float64(confIDs))
+	ch <- prometheus.MustNewConstMetric(c.metrics["consistent"],
+		prometheus.GaugeValue, boolToFloat64(consistent))
+	return nil
+}
+
+// xtradbConsistency counts distinct cluster state UUIDs and configuration IDs reported by reachable nodes.
+// The cluster is consistent if all of them report the same ones and belong to Primary component.
+func xtradbConsistency(nodes []client.XtradbMetrics) (stateUUIDs int, confIDs int, consistent bool) {
+	uuids := make(map[string]bool)
+	ids := make(map[int64]bool)
+	consistent = true
+	for _, node := range nodes {
+		if node.Err != nil {
+			continue
+		}
+		uuids[node.ClusterStateUUID] = true
+		ids[node.ClusterConfID] = true
+		if node.ClusterStatus != "Primary" || node.ClusterConfID < 0 {
+			consistent = false
+		}
+	}
+	return len(uuids), len(ids), consistent && len(uuids) == 1 && len(ids) == 1
+}
+
+// sendNodeMetrics sends metrics of Xtradb cluster node to the provided channel.
+func (c *XtradbCollector) sendNodeMetrics(ch chan<- prometheus.Metric, stats client.XtradbMetrics) {
+	ch <- prometheus.MustNewConstMetric(c.metrics["node_up"],
+		prometheus.GaugeValue, boolToFloat64(stats.Err == nil), stats.Node)
+	if stats.Err != nil {
+		return
+	}
 	ch <- prometheus.MustNewConstMetric(c.metrics["cluter_size"],
-		prometheus.GaugeValue, float64(stats.ClusterSize))
-	ch <- prometheus.MustNewConstMetric(c.metrics["node_state"],
-		prometheus.GaugeValue, float64(stats.NodeState))
-	ch <- prometheus.MustNewConstMetric(c.metrics["cluster_status"],
-		prometheus.GaugeValue, float64(stats.ClusterStatus))
+		prometheus.GaugeValue, float64(stats.ClusterSize), stats.Node)
+	sendStateSet(ch, c.metrics["node_state"], xtradbNodeStates, stats.NodeState, stats.Node)
+	sendStateSet(ch, c.metrics["cluster_status"], xtradbClusterStatuses, stats.ClusterStatus, stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["flow_control_paused_ratio"],
+		prometheus.GaugeValue, stats.FlowControlPaused, stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["flow_control_sent_total"],
+		prometheus.CounterValue, float64(stats.FlowControlSent), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["flow_control_recv_total"],
+		prometheus.CounterValue, float64(stats.FlowControlRecv), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["local_send_queue_avg"],
+		prometheus.GaugeValue, stats.LocalSendQueueAvg, stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["local_recv_queue_avg"],
+		prometheus.GaugeValue, stats.LocalRecvQueueAvg, stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["local_cert_failures_total"],
+		prometheus.CounterValue, float64(stats.LocalCertFailures), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["local_bf_aborts_total"],
+		prometheus.CounterValue, float64(stats.LocalBfAborts), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["replicated_bytes_total"],
+		prometheus.CounterValue, float64(stats.ReplicatedBytes), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["received_bytes_total"],
+		prometheus.CounterValue, float64(stats.ReceivedBytes), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["ready"],
+		prometheus.GaugeValue, boolToFloat64(stats.Ready), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["connected"],
+		prometheus.GaugeValue, boolToFloat64(stats.Connected), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["evs_state"],
+		prometheus.GaugeValue, 1, stats.Node, stats.EVSState)
+	ch <- prometheus.MustNewConstMetric(c.metrics["last_committed"],
+		prometheus.GaugeValue, float64(stats.LastCommitted), stats.Node)
+	if stats.LocalCachedDownto >= 0 {
+		ch <- prometheus.MustNewConstMetric(c.metrics["local_cached_downto"],
+			prometheus.GaugeValue, float64(stats.LocalCachedDownto), stats.Node)
+	}
+	if stats.ServerErr != nil {
+		log.Printf("Error getting Xtradb cluster node %s server stats: %v", stats.Node, stats.ServerErr)
+	}
+	if stats.Server != nil {
+		c.sendServerMetrics(ch, stats.Node, stats.Server)
+	}
+
+	transfer := stats.StateTransfer
+	ch <- prometheus.MustNewConstMetric(c.metrics["state_transfer_in_progress"],
+		prometheus.GaugeValue, boolToFloat64(transfer != nil), stats.Node)
+	if transfer == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.metrics["state_transfer_start_timestamp_seconds"],
+		prometheus.GaugeValue, float64(transfer.Start.Unix()), stats.Node, transfer.Role, transfer.Method, transfer.Peer)
+	ch <- prometheus.MustNewConstMetric(c.metrics["state_transfer_elapsed_seconds"],
+		prometheus.GaugeValue, time.Since(transfer.Start).Seconds(), stats.Node, transfer.Role, transfer.Method, transfer.Peer)
+	if !transfer.IsIST() {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.metrics["ist_seqno_start"],
+		prometheus.GaugeValue, float64(transfer.ISTSeqnoStart), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["ist_seqno_current"],
+		prometheus.GaugeValue, float64(transfer.ISTSeqnoCurrent), stats.Node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["ist_seqno_end"],
+		prometheus.GaugeValue, float64(transfer.ISTSeqnoEnd), stats.Node)
+	progress := 1.0
+	if transfer.ISTSeqnoEnd > transfer.ISTSeqnoStart {
+		progress = float64(transfer.ISTSeqnoCurrent-transfer.ISTSeqnoStart) / float64(transfer.ISTSeqnoEnd-transfer.ISTSeqnoStart)
+	}
+	ch <- prometheus.MustNewConstMetric(c.metrics["ist_progress_ratio"],
+		prometheus.GaugeValue, progress, stats.Node)
+}
+
+// sendServerMetrics sends server health metrics of Xtradb cluster node to the provided channel.
+func (c *XtradbCollector) sendServerMetrics(ch chan<- prometheus.Metric, node string, stats *client.XtradbServerMetrics) {
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_uptime_seconds"],
+		prometheus.GaugeValue, stats.Uptime.Seconds(), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_threads_connected"],
+		prometheus.GaugeValue, float64(stats.ThreadsConnected), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_threads_running"],
+		prometheus.GaugeValue, float64(stats.ThreadsRunning), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_max_connections"],
+		prometheus.GaugeValue, float64(stats.MaxConnections), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_connections_headroom"],
+		prometheus.GaugeValue, float64(stats.MaxConnections)-float64(stats.ThreadsConnected), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_aborted_connects_total"],
+		prometheus.CounterValue, float64(stats.AbortedConnects), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_innodb_buffer_pool_hit_ratio"],
+		prometheus.GaugeValue, stats.BufferPoolHitRatio(), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_innodb_buffer_pool_read_requests_total"],
+		prometheus.CounterValue, float64(stats.BufferPoolReadRequests), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_innodb_buffer_pool_reads_total"],
+		prometheus.CounterValue, float64(stats.BufferPoolReads), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_innodb_row_lock_waits_total"],
+		prometheus.CounterValue, float64(stats.RowLockWaits), node)
+	ch <- prometheus.MustNewConstMetric(c.metrics["server_innodb_row_lock_time_seconds_total"],
+		prometheus.CounterValue, stats.RowLockTime.Seconds(), node)
+	if stats.Deadlocks.Valid {
+		ch <- prometheus.MustNewConstMetric(c.metrics["server_innodb_deadlocks_total"],
+			prometheus.CounterValue, float64(stats.Deadlocks.Int64), node)
+	}
 }
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MaxFedotov/orcus-exporter/client"
+)
+
+func TestXtradbConsistency(t *testing.T) {
+	primary := func(uuid string, confID int64) client.XtradbMetrics {
+		return client.XtradbMetrics{ClusterStateUUID: uuid, ClusterConfID: confID, ClusterStatus: "Primary"}
+	}
+	tests := []struct {
+		name       string
+		nodes      []client.XtradbMetrics
+		stateUUIDs int
+		confIDs    int
+		consistent bool
+	}{
+		{name: "consistent", nodes: []client.XtradbMetrics{primary("a", 3), primary("a", 3), primary("a", 3)},
+			stateUUIDs: 1, confIDs: 1, consistent: true},
+		{name: "unreachable node", nodes: []client.XtradbMetrics{primary("a", 3), {Err: errors.New("failed")}},
+			stateUUIDs: 1, confIDs: 1, consistent: true},
+		{name: "different conf IDs", nodes: []client.XtradbMetrics{primary("a", 3), primary("a", 4)},
+			stateUUIDs: 1, confIDs: 2, consistent: false},
+		{name: "different state UUIDs", nodes: []client.XtradbMetrics{primary("a", 3), primary("b", 3)},
+			stateUUIDs: 2, confIDs: 1, consistent: false},
+		// Nodes of non-Primary component report 18446744073709551615 as wsrep_cluster_conf_id
+		{name: "split brain", nodes: []client.XtradbMetrics{
+			{ClusterStateUUID: "a", ClusterConfID: -1, ClusterStatus: "non-Primary"},
+			{ClusterStateUUID: "a", ClusterConfID: -1, ClusterStatus: "non-Primary"}},
+			stateUUIDs: 1, confIDs: 1, consistent: false},
+		{name: "undefined conf ID", nodes: []client.XtradbMetrics{primary("a", -1)},
+			stateUUIDs: 1, confIDs: 1, consistent: false},
+		{name: "no reachable nodes", nodes: []client.XtradbMetrics{{Err: errors.New("failed")}},
+			stateUUIDs: 0, confIDs: 0, consistent: false},
+	}
+	for _, test := range tests {
+		stateUUIDs, confIDs, consistent := xtradbConsistency(test.nodes)
+		if stateUUIDs != test.stateUUIDs || confIDs != test.confIDs || consistent != test.consistent {
+			t.Errorf("%s: expected %d state UUIDs, %d conf IDs, consistent %v, got %d, %d, %v", test.name,
+				test.stateUUIDs, test.confIDs, test.consistent, stateUUIDs, confIDs, consistent)
+		}
+	}
+}
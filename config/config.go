@@ -0,0 +1,604 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Probers which can be used in modules.
+var Probers = []string{"nginx", "oauth2_proxy", "orcus", "orchestrator"}
+
+// Config represents exporter configuration.
+type Config struct {
+	RetryInterval time.Duration
+	// Timeout and SSLVerify are defaults for modules without their own settings
+	Timeout             time.Duration
+	SSLVerify           bool
+	Nginx               HTTPCollector
+	Oauth2Proxy         HTTPCollector
+	Orcus               HTTPCollector
+	Orchestrator        OrchestratorCollector
+	XtradbCluster       XtradbCollector
+	OrchestratorBackend OrchestratorBackendCollector
+	Modules             map[string]*Module
+}
+
+// Module represents configuration of a module used by /probe endpoint
+// to scrape remote targets.
+type Module struct {
+	Prober  string
+	Timeout time.Duration
+	TLS     TLS
+	Auth    Auth
+}
+
+// HTTPCollector represents configuration of a collector which scrapes an HTTP endpoint.
+type HTTPCollector struct {
+	Enabled bool
+	URI     string
+	Timeout time.Duration
+	TLS     TLS
+	Auth    Auth
+}
+
+// OrchestratorCollector represents configuration of Orchestrator collector.
+// Health of URI and Endpoints is checked on every scrape, other metrics are collected from the active node.
+type OrchestratorCollector struct {
+	HTTPCollector
+	Endpoints []string
+	// DiscoverNodes enables scraping of Orchestrator nodes reported as available by known nodes.
+	// Their endpoints are URI with the host replaced by the node hostname.
+	DiscoverNodes bool
+}
+
+// XtradbCollector represents configuration of Xtradb cluster collector.
+type XtradbCollector struct {
+	Enabled bool
+	MyCnf   string
+	// MyCnfSection is read from MyCnf in addition to [client], its options take precedence
+	MyCnfSection string
+	// LoginPath is read from ~/.mylogin.cnf, its options take precedence over MyCnf
+	LoginPath string
+	// DSN is read from DATA_SOURCE_NAME environment variable, MyCnf is not read if it is set
+	DSN string
+	// Host, Port and credentials from UserFile and PasswordFile take precedence over DSN and MyCnf
+	Host         string
+	Port         int
+	UserFile     string
+	PasswordFile string
+	Timeout      time.Duration
+	TLS          TLS
+	// Nodes are addresses of other cluster nodes scraped with credentials from MyCnf
+	Nodes []string
+	// DiscoverNodes enables scraping of nodes from wsrep_incoming_addresses
+	DiscoverNodes bool
+	// Server enables collection of server health metrics
+	Server bool
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime limit connection pool of every node kept between scrapes
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// OrchestratorBackendCollector represents configuration of Orchestrator backend database collector.
+type OrchestratorBackendCollector struct {
+	Enabled bool
+	MyCnf   string
+	// MyCnfSection is read from MyCnf in addition to [client], its options take precedence
+	MyCnfSection string
+	// LoginPath is read from ~/.mylogin.cnf, its options take precedence over MyCnf
+	LoginPath string
+	Database  string
+	Timeout   time.Duration
+	TLS       TLS
+	// PollInterval is InstancePollSeconds of Orchestrator, instances not checked within it are reported
+	PollInterval time.Duration
+}
+
+// TLS represents TLS settings of a collector.
+type TLS struct {
+	SSLVerify bool
+	CAFile    string
+	CertFile  string
+	KeyFile   string
+}
+
+// Auth represents credentials and headers added to every request of a collector.
+// Passwords and tokens from files are read when configuration is loaded.
+type Auth struct {
+	Username    string
+	Password    string
+	BearerToken string
+	Headers     map[string]string
+}
+
+type fileConfig struct {
+	RetryInterval string `yaml:"retry_interval"`
+	Timeout       string `yaml:"timeout"`
+	SSLVerify     *bool  `yaml:"ssl_verify"`
+	Collectors    struct {
+		Nginx               *fileHTTPCollector                `yaml:"nginx"`
+		Oauth2Proxy         *fileHTTPCollector                `yaml:"oauth2_proxy"`
+		Orcus               *fileHTTPCollector                `yaml:"orcus"`
+		Orchestrator        *fileOrchestratorCollector        `yaml:"orchestrator"`
+		XtradbCluster       *fileXtradbCollector              `yaml:"xtradb_cluster"`
+		OrchestratorBackend *fileOrchestratorBackendCollector `yaml:"orchestrator_backend"`
+	} `yaml:"collectors"`
+	Modules map[string]*fileModule `yaml:"modules"`
+}
+
+type fileModule struct {
+	Prober  string    `yaml:"prober"`
+	Timeout string    `yaml:"timeout"`
+	TLS     *fileTLS  `yaml:"tls"`
+	Auth    *fileAuth `yaml:"auth"`
+}
+
+type fileHTTPCollector struct {
+	Enabled *bool     `yaml:"enabled"`
+	URI     string    `yaml:"uri"`
+	Timeout string    `yaml:"timeout"`
+	TLS     *fileTLS  `yaml:"tls"`
+	Auth    *fileAuth `yaml:"auth"`
+}
+
+type fileOrchestratorCollector struct {
+	fileHTTPCollector `yaml:",inline"`
+	Endpoints         []string `yaml:"endpoints"`
+	DiscoverNodes     *bool    `yaml:"discover_nodes"`
+}
+
+type fileXtradbCollector struct {
+	Enabled         *bool    `yaml:"enabled"`
+	MyCnf           string   `yaml:"my_cnf"`
+	MyCnfSection    string   `yaml:"my_cnf_section"`
+	LoginPath       string   `yaml:"login_path"`
+	Host            string   `yaml:"host"`
+	Port            int      `yaml:"port"`
+	UserFile        string   `yaml:"user_file"`
+	PasswordFile    string   `yaml:"password_file"`
+	Timeout         string   `yaml:"timeout"`
+	TLS             *fileTLS `yaml:"tls"`
+	Nodes           []string `yaml:"nodes"`
+	DiscoverNodes   *bool    `yaml:"discover_nodes"`
+	MaxOpenConns    *int     `yaml:"max_open_conns"`
+	MaxIdleConns    *int     `yaml:"max_idle_conns"`
+	ConnMaxLifetime string   `yaml:"conn_max_lifetime"`
+
+	// Sub-collectors
+	Server *fileXtradbServer `yaml:"server"`
+}
+
+type fileXtradbServer struct {
+	Enabled *bool `yaml:"enabled"`
+}
+
+type fileOrchestratorBackendCollector struct {
+	Enabled      *bool    `yaml:"enabled"`
+	MyCnf        string   `yaml:"my_cnf"`
+	MyCnfSection string   `yaml:"my_cnf_section"`
+	LoginPath    string   `yaml:"login_path"`
+	Database     string   `yaml:"database"`
+	Timeout      string   `yaml:"timeout"`
+	TLS          *fileTLS `yaml:"tls"`
+	PollInterval string   `yaml:"poll_interval"`
+}
+
+type fileTLS struct {
+	SSLVerify *bool  `yaml:"ssl_verify"`
+	CAFile    string `yaml:"ca_file"`
+	CertFile  string `yaml:"cert_file"`
+	KeyFile   string `yaml:"key_file"`
+}
+
+type fileAuth struct {
+	Username        string            `yaml:"username"`
+	Password        string            `yaml:"password"`
+	PasswordFile    string            `yaml:"password_file"`
+	BearerToken     string            `yaml:"bearer_token"`
+	BearerTokenFile string            `yaml:"bearer_token_file"`
+	Headers         map[string]string `yaml:"headers"`
+}
+
+// Defaults are global settings set outside of configuration file, e.g. with flags. Unset ones are nil.
+// They take precedence over global settings of the file, but not over settings of collector and module sections.
+type Defaults struct {
+	Timeout   *time.Duration
+	SSLVerify *bool
+}
+
+// LoadFile reads configuration file and applies its values on top of cfg.
+// Unknown keys and invalid values are reported as errors.
+func LoadFile(filename string, cfg *Config, defaults Defaults) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", filename, err)
+	}
+	var file fileConfig
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", filename, err)
+	}
+	if err := file.apply(cfg, defaults); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", filename, err)
+	}
+	return nil
+}
+
+// Validate checks that configuration of enabled collectors is complete.
+func (cfg *Config) Validate() error {
+	for name, c := range map[string]HTTPCollector{
+		"nginx":        cfg.Nginx,
+		"oauth2_proxy": cfg.Oauth2Proxy,
+		"orcus":        cfg.Orcus,
+		"orchestrator": cfg.Orchestrator.HTTPCollector,
+	} {
+		if !c.Enabled {
+			continue
+		}
+		if c.URI == "" {
+			return fmt.Errorf("collectors.%s.uri: must be set for enabled collector", name)
+		}
+		if c.Timeout <= 0 {
+			return fmt.Errorf("collectors.%s.timeout: must be positive", name)
+		}
+	}
+	if cfg.XtradbCluster.Enabled {
+		if cfg.XtradbCluster.MyCnf == "" && cfg.XtradbCluster.DSN == "" {
+			return fmt.Errorf("collectors.xtradb_cluster.my_cnf: must be set for enabled collector without DATA_SOURCE_NAME")
+		}
+		if cfg.XtradbCluster.Port < 0 || cfg.XtradbCluster.Port > 65535 {
+			return fmt.Errorf("collectors.xtradb_cluster.port: must be between 0 and 65535")
+		}
+		if cfg.XtradbCluster.Timeout <= 0 {
+			return fmt.Errorf("collectors.xtradb_cluster.timeout: must be positive")
+		}
+		if cfg.XtradbCluster.MaxOpenConns < 1 {
+			return fmt.Errorf("collectors.xtradb_cluster.max_open_conns: must be positive")
+		}
+		if cfg.XtradbCluster.MaxIdleConns < 0 {
+			return fmt.Errorf("collectors.xtradb_cluster.max_idle_conns: must not be negative")
+		}
+		// Connections without lifetime would be kept open forever
+		if cfg.XtradbCluster.ConnMaxLifetime <= 0 {
+			return fmt.Errorf("collectors.xtradb_cluster.conn_max_lifetime: must be positive")
+		}
+	}
+	if cfg.OrchestratorBackend.Enabled {
+		if cfg.OrchestratorBackend.MyCnf == "" {
+			return fmt.Errorf("collectors.orchestrator_backend.my_cnf: must be set for enabled collector")
+		}
+		if cfg.OrchestratorBackend.Database == "" {
+			return fmt.Errorf("collectors.orchestrator_backend.database: must be set for enabled collector")
+		}
+		if cfg.OrchestratorBackend.Timeout <= 0 {
+			return fmt.Errorf("collectors.orchestrator_backend.timeout: must be positive")
+		}
+		if cfg.OrchestratorBackend.PollInterval <= 0 {
+			return fmt.Errorf("collectors.orchestrator_backend.poll_interval: must be positive")
+		}
+	}
+	for name, m := range cfg.Modules {
+		if !isKnownProber(m.Prober) {
+			return fmt.Errorf("modules.%s.prober: unknown prober %q, must be one of %v", name, m.Prober, Probers)
+		}
+		if m.Timeout <= 0 {
+			return fmt.Errorf("modules.%s.timeout: must be positive", name)
+		}
+	}
+	return nil
+}
+
+func isKnownProber(prober string) bool {
+	for _, p := range Probers {
+		if p == prober {
+			return true
+		}
+	}
+	return false
+}
+
+func (file *fileConfig) apply(cfg *Config, defaults Defaults) error {
+	if file.RetryInterval != "" {
+		d, err := parseDuration("retry_interval", file.RetryInterval)
+		if err != nil {
+			return err
+		}
+		cfg.RetryInterval = d
+	}
+	// Global timeout and ssl_verify are defaults for every collector and
+	// can be overridden in the collector section.
+	if file.Timeout != "" {
+		d, err := parseDuration("timeout", file.Timeout)
+		if err != nil {
+			return err
+		}
+		if defaults.Timeout == nil {
+			defaults.Timeout = &d
+		}
+	}
+	if defaults.Timeout != nil {
+		d := *defaults.Timeout
+		cfg.Timeout = d
+		cfg.Nginx.Timeout = d
+		cfg.Oauth2Proxy.Timeout = d
+		cfg.Orcus.Timeout = d
+		cfg.Orchestrator.Timeout = d
+		cfg.XtradbCluster.Timeout = d
+		cfg.OrchestratorBackend.Timeout = d
+	}
+	if defaults.SSLVerify == nil {
+		defaults.SSLVerify = file.SSLVerify
+	}
+	if defaults.SSLVerify != nil {
+		v := *defaults.SSLVerify
+		cfg.SSLVerify = v
+		cfg.Nginx.TLS.SSLVerify = v
+		cfg.Oauth2Proxy.TLS.SSLVerify = v
+		cfg.Orcus.TLS.SSLVerify = v
+		cfg.Orchestrator.TLS.SSLVerify = v
+		cfg.XtradbCluster.TLS.SSLVerify = v
+		cfg.OrchestratorBackend.TLS.SSLVerify = v
+	}
+
+	if err := file.Collectors.Nginx.apply("collectors.nginx", &cfg.Nginx); err != nil {
+		return err
+	}
+	if err := file.Collectors.Oauth2Proxy.apply("collectors.oauth2_proxy", &cfg.Oauth2Proxy); err != nil {
+		return err
+	}
+	if err := file.Collectors.Orcus.apply("collectors.orcus", &cfg.Orcus); err != nil {
+		return err
+	}
+	if err := file.Collectors.Orchestrator.apply("collectors.orchestrator", &cfg.Orchestrator); err != nil {
+		return err
+	}
+	if err := file.Collectors.XtradbCluster.apply("collectors.xtradb_cluster", &cfg.XtradbCluster); err != nil {
+		return err
+	}
+	if err := file.Collectors.OrchestratorBackend.apply("collectors.orchestrator_backend", &cfg.OrchestratorBackend); err != nil {
+		return err
+	}
+
+	if len(file.Modules) > 0 {
+		cfg.Modules = make(map[string]*Module, len(file.Modules))
+	}
+	for name, fm := range file.Modules {
+		m := &Module{
+			Timeout: cfg.Timeout,
+			TLS:     TLS{SSLVerify: cfg.SSLVerify},
+		}
+		if err := fm.apply("modules."+name, m); err != nil {
+			return err
+		}
+		cfg.Modules[name] = m
+	}
+	return nil
+}
+
+func (file *fileModule) apply(key string, m *Module) error {
+	if file == nil {
+		return fmt.Errorf("%s: module must not be empty", key)
+	}
+	m.Prober = file.Prober
+	if file.Timeout != "" {
+		d, err := parseDuration(key+".timeout", file.Timeout)
+		if err != nil {
+			return err
+		}
+		m.Timeout = d
+	}
+	file.TLS.apply(&m.TLS)
+	return file.Auth.apply(key+".auth", &m.Auth)
+}
+
+func (file *fileHTTPCollector) apply(key string, c *HTTPCollector) error {
+	if file == nil {
+		return nil
+	}
+	if file.Enabled != nil {
+		c.Enabled = *file.Enabled
+	}
+	if file.URI != "" {
+		c.URI = file.URI
+	}
+	if file.Timeout != "" {
+		d, err := parseDuration(key+".timeout", file.Timeout)
+		if err != nil {
+			return err
+		}
+		c.Timeout = d
+	}
+	file.TLS.apply(&c.TLS)
+	return file.Auth.apply(key+".auth", &c.Auth)
+}
+
+func (file *fileOrchestratorCollector) apply(key string, c *OrchestratorCollector) error {
+	if file == nil {
+		return nil
+	}
+	if err := file.fileHTTPCollector.apply(key, &c.HTTPCollector); err != nil {
+		return err
+	}
+	if len(file.Endpoints) > 0 {
+		c.Endpoints = file.Endpoints
+	}
+	if file.DiscoverNodes != nil {
+		c.DiscoverNodes = *file.DiscoverNodes
+	}
+	return nil
+}
+
+func (file *fileXtradbCollector) apply(key string, c *XtradbCollector) error {
+	if file == nil {
+		return nil
+	}
+	if file.Enabled != nil {
+		c.Enabled = *file.Enabled
+	}
+	if file.MyCnf != "" {
+		c.MyCnf = file.MyCnf
+	}
+	if file.MyCnfSection != "" {
+		c.MyCnfSection = file.MyCnfSection
+	}
+	if file.LoginPath != "" {
+		c.LoginPath = file.LoginPath
+	}
+	if file.Timeout != "" {
+		d, err := parseDuration(key+".timeout", file.Timeout)
+		if err != nil {
+			return err
+		}
+		c.Timeout = d
+	}
+	if file.Host != "" {
+		c.Host = file.Host
+	}
+	if file.Port != 0 {
+		c.Port = file.Port
+	}
+	if file.UserFile != "" {
+		c.UserFile = file.UserFile
+	}
+	if file.PasswordFile != "" {
+		c.PasswordFile = file.PasswordFile
+	}
+	file.TLS.apply(&c.TLS)
+	if len(file.Nodes) > 0 {
+		c.Nodes = file.Nodes
+	}
+	if file.DiscoverNodes != nil {
+		c.DiscoverNodes = *file.DiscoverNodes
+	}
+	if file.Server != nil && file.Server.Enabled != nil {
+		c.Server = *file.Server.Enabled
+	}
+	if file.MaxOpenConns != nil {
+		c.MaxOpenConns = *file.MaxOpenConns
+	}
+	if file.MaxIdleConns != nil {
+		c.MaxIdleConns = *file.MaxIdleConns
+	}
+	if file.ConnMaxLifetime != "" {
+		d, err := parseDuration(key+".conn_max_lifetime", file.ConnMaxLifetime)
+		if err != nil {
+			return err
+		}
+		c.ConnMaxLifetime = d
+	}
+	return nil
+}
+
+func (file *fileOrchestratorBackendCollector) apply(key string, c *OrchestratorBackendCollector) error {
+	if file == nil {
+		return nil
+	}
+	if file.Enabled != nil {
+		c.Enabled = *file.Enabled
+	}
+	if file.MyCnf != "" {
+		c.MyCnf = file.MyCnf
+	}
+	if file.MyCnfSection != "" {
+		c.MyCnfSection = file.MyCnfSection
+	}
+	if file.LoginPath != "" {
+		c.LoginPath = file.LoginPath
+	}
+	if file.Database != "" {
+		c.Database = file.Database
+	}
+	if file.Timeout != "" {
+		d, err := parseDuration(key+".timeout", file.Timeout)
+		if err != nil {
+			return err
+		}
+		c.Timeout = d
+	}
+	file.TLS.apply(&c.TLS)
+	if file.PollInterval != "" {
+		d, err := parseDuration(key+".poll_interval", file.PollInterval)
+		if err != nil {
+			return err
+		}
+		c.PollInterval = d
+	}
+	return nil
+}
+
+func (file *fileTLS) apply(tls *TLS) {
+	if file == nil {
+		return
+	}
+	if file.SSLVerify != nil {
+		tls.SSLVerify = *file.SSLVerify
+	}
+	if file.CAFile != "" {
+		tls.CAFile = file.CAFile
+	}
+	if file.CertFile != "" {
+		tls.CertFile = file.CertFile
+	}
+	if file.KeyFile != "" {
+		tls.KeyFile = file.KeyFile
+	}
+}
+
+func (file *fileAuth) apply(key string, auth *Auth) error {
+	if file == nil {
+		return nil
+	}
+	if file.Password != "" && file.PasswordFile != "" {
+		return fmt.Errorf("%s: only one of password and password_file can be set", key)
+	}
+	if file.BearerToken != "" && file.BearerTokenFile != "" {
+		return fmt.Errorf("%s: only one of bearer_token and bearer_token_file can be set", key)
+	}
+	if file.Username != "" && (file.BearerToken != "" || file.BearerTokenFile != "") {
+		return fmt.Errorf("%s: basic auth and bearer token can not be used together", key)
+	}
+	auth.Username = file.Username
+	auth.Password = file.Password
+	auth.BearerToken = file.BearerToken
+	auth.Headers = file.Headers
+	if file.PasswordFile != "" {
+		password, err := ReadSecretFile(file.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("%s.password_file: %v", key, err)
+		}
+		auth.Password = password
+	}
+	if file.BearerTokenFile != "" {
+		token, err := ReadSecretFile(file.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("%s.bearer_token_file: %v", key, err)
+		}
+		auth.BearerToken = token
+	}
+	return nil
+}
+
+// ReadSecretFile reads a user, a password or a token from file. Trailing newline, which is usual
+// for mounted secrets, is ignored.
+func ReadSecretFile(filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func parseDuration(key string, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid duration %q: %v", key, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: duration must be positive, got %q", key, value)
+	}
+	return d, nil
+}
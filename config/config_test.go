@@ -0,0 +1,119 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, dir string, content string) string {
+	filename := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "unknown key", content: "collectors:\n  nginx:\n    url: http://127.0.0.1\n", err: "field url not found"},
+		{name: "removed retries key", content: "retries: 3\n", err: "field retries not found"},
+		{name: "invalid duration", content: "collectors:\n  orchestrator_backend:\n    poll_interval: 5\n",
+			err: `collectors.orchestrator_backend.poll_interval: invalid duration "5"`},
+		{name: "negative duration", content: "collectors:\n  xtradb_cluster:\n    timeout: -1s\n",
+			err: `collectors.xtradb_cluster.timeout: duration must be positive`},
+		{name: "module timeout", content: "modules:\n  web:\n    prober: nginx\n    timeout: 1x\n",
+			err: `modules.web.timeout: invalid duration "1x"`},
+		{name: "module auth", content: "modules:\n  web:\n    prober: nginx\n    auth:\n      password: a\n      password_file: /a\n",
+			err: "modules.web.auth: only one of password and password_file can be set"},
+	}
+	for _, test := range tests {
+		err := LoadFile(writeConfigFile(t, dir, test.content), &Config{}, Defaults{})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestLoadFileDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := writeConfigFile(t, dir, `
+timeout: 3s
+ssl_verify: false
+collectors:
+  nginx:
+    timeout: 10s
+    tls:
+      ssl_verify: false
+modules:
+  web:
+    prober: nginx
+  slow:
+    prober: orcus
+    timeout: 20s
+`)
+
+	timeout := 7 * time.Second
+	sslVerify := true
+	tests := []struct {
+		name                string
+		defaults            Defaults
+		globalTimeout       time.Duration
+		globalVerify        bool
+		nginxTimeout        time.Duration
+		nginxVerify         bool
+		webTimeout          time.Duration
+		slowTimeout         time.Duration
+		orchestratorTimeout time.Duration
+	}{
+		{name: "file", globalTimeout: 3 * time.Second, nginxTimeout: 10 * time.Second,
+			webTimeout: 3 * time.Second, slowTimeout: 20 * time.Second, orchestratorTimeout: 3 * time.Second},
+		// Defaults override global settings of the file, but not settings of sections
+		{name: "flags", defaults: Defaults{Timeout: &timeout, SSLVerify: &sslVerify},
+			globalTimeout: timeout, globalVerify: true, nginxTimeout: 10 * time.Second,
+			webTimeout: timeout, slowTimeout: 20 * time.Second, orchestratorTimeout: timeout},
+	}
+	for _, test := range tests {
+		cfg := &Config{}
+		if err := LoadFile(filename, cfg, test.defaults); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if cfg.Timeout != test.globalTimeout || cfg.SSLVerify != test.globalVerify {
+			t.Errorf("%s: expected global timeout %v and ssl_verify %v, got %v and %v", test.name,
+				test.globalTimeout, test.globalVerify, cfg.Timeout, cfg.SSLVerify)
+		}
+		if cfg.Nginx.Timeout != test.nginxTimeout || cfg.Nginx.TLS.SSLVerify != test.nginxVerify {
+			t.Errorf("%s: expected nginx timeout %v and ssl_verify %v, got %v and %v", test.name,
+				test.nginxTimeout, test.nginxVerify, cfg.Nginx.Timeout, cfg.Nginx.TLS.SSLVerify)
+		}
+		if cfg.Orchestrator.Timeout != test.orchestratorTimeout || cfg.Orchestrator.TLS.SSLVerify != test.globalVerify {
+			t.Errorf("%s: expected orchestrator timeout %v and ssl_verify %v, got %v and %v", test.name,
+				test.orchestratorTimeout, test.globalVerify, cfg.Orchestrator.Timeout, cfg.Orchestrator.TLS.SSLVerify)
+		}
+		if cfg.Modules["web"].Timeout != test.webTimeout || cfg.Modules["slow"].Timeout != test.slowTimeout {
+			t.Errorf("%s: expected module timeouts %v and %v, got %v and %v", test.name,
+				test.webTimeout, test.slowTimeout, cfg.Modules["web"].Timeout, cfg.Modules["slow"].Timeout)
+		}
+		if cfg.Modules["web"].TLS.SSLVerify != test.globalVerify {
+			t.Errorf("%s: expected module ssl_verify %v, got %v", test.name, test.globalVerify, cfg.Modules["web"].TLS.SSLVerify)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewTLSConfig creates a tls.Config from TLS settings of a collector.
+func NewTLSConfig(cfg TLS) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: !cfg.SSLVerify}
+	if cfg.CAFile != "" {
+		pemCA, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %v", cfg.CAFile, err)
+		}
+		caBundle := x509.NewCertPool()
+		if ok := caBundle.AppendCertsFromPEM(pemCA); !ok {
+			return nil, fmt.Errorf("failed parse pem-encoded CA certificates from %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = caBundle
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("both cert_file and key_file must be set for client certificate")
+	}
+	if cfg.CertFile != "" {
+		keypair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pem-encoded SSL cert %s or SSL key %s: %v",
+				cfg.CertFile, cfg.KeyFile, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{keypair}
+	}
+	return tlsCfg, nil
+}
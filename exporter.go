@@ -1,18 +1,24 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/MaxFedotov/orcus-exporter/client"
 	"github.com/MaxFedotov/orcus-exporter/collector"
+	"github.com/MaxFedotov/orcus-exporter/config"
 	nginxclient "github.com/nginxinc/nginx-prometheus-exporter/client"
 	nginxcollector "github.com/nginxinc/nginx-prometheus-exporter/collector"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,7 +31,8 @@ var (
 	date               = "unknown"
 	listenAddress      = flag.String("web.listen-address", ":9114", "Address to listen on for web interface")
 	metricsPath        = flag.String("web.metrics-path", "/metrics", "Path under which to expose metrics")
-	retries            = flag.Uint("config.retries", 0, "Number of retries the exporter will make on start in order to inialize collectors")
+	configFile         = flag.String("config.file", "", "Path to configuration file. Flags set explicitly override values from the file")
+	_                  = flag.Uint("config.retries", 0, "Deprecated and ignored, collectors which fail to initialize on start are retried on scrapes")
 	retryInterval      = flag.Duration("config.retry-interval", time.Second*5, "Interval between retries to connect to collectors endpoint")
 	timeout            = flag.Duration("config.timeout", time.Second*5, "Timeout for scraping metrics for collector")
 	sslVerify          = flag.Bool("config.ssl-verify", false, "Verify SSL certificates")
@@ -37,21 +44,198 @@ var (
 	orcusURI           = flag.String("collector.orcus.uri", "http://127.0.0.1:3008/metrics", "URI for scraping orcus metrics")
 	orchestrator       = flag.Bool("collector.orchestrator", true, "Collect data for orchestrator")
 	orchestratorURI    = flag.String("collector.orchestrator.uri", "http://127.0.0.1:3000/api", "URI for scraping orchestrator metrics")
+	orchestratorNodes  = flag.String("collector.orchestrator.endpoints", "", "Comma separated list of URIs of other orchestrator nodes to check")
+	discoverNodes      = flag.Bool("collector.orchestrator.discover-nodes", false, "Check orchestrator nodes reported as available by known nodes")
 	xtradbCluster      = flag.Bool("collector.xtradb-cluster", true, "Collect data for XtraDB cluster")
 	xtradbClusterMycnf = flag.String("collector.xtradb-cluster.my-cnf", path.Join(os.Getenv("HOME"), ".my.cnf"), "Path to .my.cnf file to read MySQL credentials from")
+	xtradbClusterNodes = flag.String("collector.xtradb-cluster.nodes", "", "Comma separated list of host:port addresses of other XtraDB cluster nodes to scrape")
+	xtradbDiscovery    = flag.Bool("collector.xtradb-cluster.discover-nodes", false, "Scrape XtraDB cluster nodes from wsrep_incoming_addresses")
+	xtradbServer       = flag.Bool("collector.xtradb-cluster.server", true, "Collect server health data for XtraDB cluster nodes")
+
+	orchestratorBackend      = flag.Bool("collector.orchestrator-backend", false, "Collect data from orchestrator backend database")
+	orchestratorBackendMycnf = flag.String("collector.orchestrator-backend.my-cnf", path.Join(os.Getenv("HOME"), ".my.cnf"), "Path to .my.cnf file to read orchestrator backend database credentials from")
+
+	xtradbClusterMycnfSection = flag.String("collector.xtradb-cluster.my-cnf-section", "", "Section of .my.cnf file read in addition to [client] for XtraDB cluster")
+	xtradbClusterLoginPath    = flag.String("collector.xtradb-cluster.login-path", "", "Login path of ~/.mylogin.cnf file to read MySQL credentials from")
+
+	xtradbClusterHost         = flag.String("collector.xtradb-cluster.host", "", "Host of XtraDB cluster node, overrides DATA_SOURCE_NAME and .my.cnf")
+	xtradbClusterPort         = flag.Int("collector.xtradb-cluster.port", 0, "Port of XtraDB cluster node, overrides DATA_SOURCE_NAME and .my.cnf")
+	xtradbClusterUserFile     = flag.String("collector.xtradb-cluster.user-file", os.Getenv("MYSQL_USER_FILE"), "Path to file with MySQL user, overrides DATA_SOURCE_NAME and .my.cnf")
+	xtradbClusterPasswordFile = flag.String("collector.xtradb-cluster.password-file", os.Getenv("MYSQL_PASSWORD_FILE"), "Path to file with MySQL password, overrides DATA_SOURCE_NAME and .my.cnf")
+	xtradbClusterCAFile       = flag.String("collector.xtradb-cluster.tls.ca-file", "", "Path to CA certificate to verify XtraDB cluster nodes")
+	xtradbClusterCertFile     = flag.String("collector.xtradb-cluster.tls.cert-file", "", "Path to client certificate for XtraDB cluster nodes")
+	xtradbClusterKeyFile      = flag.String("collector.xtradb-cluster.tls.key-file", "", "Path to client key for XtraDB cluster nodes")
 )
 
 func main() {
 	flag.Parse()
 	log.Printf("Starting Orcus Prometheus Exporter Version=%v GitCommit=%v Date=%v", version, commit, date)
 
+	exp := &exporter{}
+	if err := exp.reload(); err != nil {
+		log.Fatalf("Could not initialize exporter: %v", err)
+	}
+
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGTERM)
+	signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		log.Printf("SIGTERM received: %v. Exiting...", <-signalChan)
-		os.Exit(0)
+		for sig := range signalChan {
+			if sig == syscall.SIGHUP {
+				log.Printf("SIGHUP received. Reloading configuration...")
+				if err := exp.reload(); err != nil {
+					log.Printf("Error reloading configuration, keeping the previous one: %v", err)
+					continue
+				}
+				log.Printf("Configuration has been successfully reloaded")
+				continue
+			}
+			log.Printf("SIGTERM received: %v. Exiting...", sig)
+			os.Exit(0)
+		}
 	}()
 
+	http.Handle(*metricsPath, exp)
+	http.HandleFunc("/probe", exp.probe)
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := exp.reload(); err != nil {
+			log.Printf("Error reloading configuration, keeping the previous one: %v", err)
+			http.Error(w, fmt.Sprintf("failed to reload configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Configuration has been successfully reloaded")
+	})
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`<html>
+			<head><title>Orcus Exporter</title></head>
+			<body>
+			<h1>Orcus Exporter</h1>
+			<p><a href='/metrics'>Metrics</a></p>
+			<p>Remote targets can be scraped with /probe?target=&lt;uri&gt;&amp;module=&lt;module&gt;</p>
+			</body>
+			</html>`))
+		if err != nil {
+			log.Printf("Error while sending a response for the '/' path: %v", err)
+		}
+	})
+	log.Printf("Orcus Prometheus Exporter has successfully started")
+	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+}
+
+// exporter serves metrics from the registry built for the current configuration.
+type exporter struct {
+	mutex sync.Mutex // To serialize reloads
+	state atomic.Value
+}
+
+// exporterState holds the current configuration and the handler for its registry.
+type exporterState struct {
+	cfg     *config.Config
+	handler http.Handler
+	// closer releases resources held by collectors of the registry
+	closer io.Closer
+}
+
+// ServeHTTP serves metrics using the most recently loaded registry.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.state.Load().(*exporterState).handler.ServeHTTP(w, r)
+}
+
+// probe scrapes the target using client and collector of the requested module
+// and serves the result.
+func (e *exporter) probe(w http.ResponseWriter, r *http.Request) {
+	cfg := e.state.Load().(*exporterState).cfg
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := r.URL.Query().Get("module")
+	module, ok := cfg.Modules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+
+	httpClient, err := newHTTPClient(config.HTTPCollector{URI: target, Timeout: module.Timeout, TLS: module.TLS, Auth: module.Auth})
+	if err != nil {
+		log.Printf("Error creating HTTP client for module %s: %v", moduleName, err)
+		http.Error(w, fmt.Sprintf("failed to create HTTP client: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer httpClient.CloseIdleConnections()
+
+	registry := prometheus.NewRegistry()
+	probeCollector, err := newProbeCollector(module.Prober, target, httpClient)
+	if err != nil {
+		log.Printf("Error probing %s target %s: %v", module.Prober, target, err)
+		upMetric := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: module.Prober,
+			Name:      "up",
+			Help:      "Status of the last metric scrape",
+		})
+		registry.MustRegister(upMetric)
+	} else {
+		registry.MustRegister(probeCollector)
+	}
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// newProbeCollector creates a client for the target and a collector for it. Availability of the target
+// is checked by the scrape, except nginx, whose client checks it on creation.
+func newProbeCollector(prober string, target string, httpClient *http.Client) (prometheus.Collector, error) {
+	switch prober {
+	case "nginx":
+		nginxClient, err := nginxclient.NewNginxClient(httpClient, target)
+		if err != nil {
+			return nil, err
+		}
+		return nginxcollector.NewNginxCollector(nginxClient, prober), nil
+	case "oauth2_proxy":
+		return collector.NewOauth2ProxyCollector(client.NewOauth2ProxyProbeClient(httpClient, target), prober), nil
+	case "orcus":
+		return collector.NewOrcusCollector(client.NewOrcusProbeClient(httpClient, target), prober), nil
+	case "orchestrator":
+		return collector.NewOrchestratorCollector(client.NewOrchestratorProbeClient(httpClient, target), prober), nil
+	}
+	return nil, fmt.Errorf("unknown prober %q", prober)
+}
+
+// reload reads configuration, builds a new registry and replaces the current one.
+// The current registry is kept if the new configuration is invalid.
+func (e *exporter) reload() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("could not load configuration: %v", err)
+	}
+	registry, closer, err := newRegistry(cfg)
+	if err != nil {
+		return err
+	}
+	previous, _ := e.state.Load().(*exporterState)
+	e.state.Store(&exporterState{
+		cfg:     cfg,
+		handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+		closer:  closer,
+	})
+	// Scrapes of the previous registry in progress are finished before its collectors are closed
+	if previous != nil {
+		if err := previous.closer.Close(); err != nil {
+			log.Printf("Error closing collectors of the previous configuration: %v", err)
+		}
+	}
+	return nil
+}
+
+// newRegistry creates clients and collectors enabled in cfg and registers them
+// in a new registry. The returned closer releases resources held by the collectors.
+func newRegistry(cfg *config.Config) (*prometheus.Registry, io.Closer, error) {
 	registry := prometheus.NewRegistry()
 
 	buildInfoMetric := prometheus.NewGauge(
@@ -67,83 +251,285 @@ func main() {
 	)
 	buildInfoMetric.Set(1)
 
-	registry.MustRegister(buildInfoMetric)
-
-	httpClient := &http.Client{
-		Timeout: *timeout,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: !*sslVerify},
-		},
+	if err := registry.Register(buildInfoMetric); err != nil {
+		return nil, nil, err
 	}
 
-	if *nginx {
+	collectors := map[string]func(ctx context.Context) (collector.Collector, error){}
+	// httpClients are kept to close their idle connections when the registry is replaced
+	var httpClients []*http.Client
+
+	if cfg.Nginx.Enabled {
 		service := "nginx"
-		nginxClient, err := client.CreateClientWithRetries(service, func() (interface{}, error) {
-			return nginxclient.NewNginxClient(httpClient, *nginxURI)
-		}, *retries, *retryInterval)
+		httpClient, err := newHTTPClient(cfg.Nginx)
 		if err != nil {
-			log.Fatalf("Could not create Nginx Client: %v", err)
+			return nil, nil, fmt.Errorf("could not create HTTP client for Nginx: %v", err)
+		}
+		httpClients = append(httpClients, httpClient)
+		collectors[service] = func(ctx context.Context) (collector.Collector, error) {
+			// Nginx client does not accept ctx, its check is limited by the timeout of httpClient
+			nginxClient, err := nginxclient.NewNginxClient(httpClient, cfg.Nginx.URI)
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewPrometheusCollector(nginxcollector.NewNginxCollector(nginxClient, service)), nil
 		}
-		registry.MustRegister(nginxcollector.NewNginxCollector(nginxClient.(*nginxclient.NginxClient), service))
 	}
 
-	if *oauth2Proxy {
+	if cfg.Oauth2Proxy.Enabled {
 		service := "oauth2_proxy"
-		oauth2ProxyClient, err := client.CreateClientWithRetries(service, func() (interface{}, error) {
-			return client.NewOauth2ProxyClient(httpClient, *oauth2ProxyURI)
-		}, *retries, *retryInterval)
+		httpClient, err := newHTTPClient(cfg.Oauth2Proxy)
 		if err != nil {
-			log.Fatalf("Could not create oauth2_proxy Client: %v", err)
+			return nil, nil, fmt.Errorf("could not create HTTP client for oauth2_proxy: %v", err)
+		}
+		httpClients = append(httpClients, httpClient)
+		collectors[service] = func(ctx context.Context) (collector.Collector, error) {
+			oauth2ProxyClient, err := client.NewOauth2ProxyClient(ctx, httpClient, cfg.Oauth2Proxy.URI)
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewOauth2ProxyCollector(oauth2ProxyClient, service), nil
 		}
-		registry.MustRegister(collector.NewOauth2ProxyCollector(oauth2ProxyClient.(*client.Oauth2ProxyClient), service))
 	}
 
-	if *orcus {
+	if cfg.Orcus.Enabled {
 		service := "orcus"
-		orcusClient, err := client.CreateClientWithRetries(service, func() (interface{}, error) {
-			return client.NewOrcusClient(httpClient, *orcusURI)
-		}, *retries, *retryInterval)
+		httpClient, err := newHTTPClient(cfg.Orcus)
 		if err != nil {
-			log.Fatalf("Could not create Orcus Client: %v", err)
+			return nil, nil, fmt.Errorf("could not create HTTP client for Orcus: %v", err)
+		}
+		httpClients = append(httpClients, httpClient)
+		collectors[service] = func(ctx context.Context) (collector.Collector, error) {
+			orcusClient, err := client.NewOrcusClient(ctx, httpClient, cfg.Orcus.URI)
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewOrcusCollector(orcusClient, service), nil
 		}
-		registry.MustRegister(collector.NewOrcusCollector(orcusClient.(*client.OrcusClient), service))
 	}
 
-	if *orchestrator {
+	if cfg.Orchestrator.Enabled {
 		service := "orchestrator"
-		orchestatorClient, err := client.CreateClientWithRetries(service, func() (interface{}, error) {
-			return client.NewOrchestratorClient(httpClient, *orchestratorURI)
-		}, *retries, *retryInterval)
+		httpClient, err := newHTTPClient(cfg.Orchestrator.HTTPCollector)
 		if err != nil {
-			log.Fatalf("Could not create Orchestrator Client: %v", err)
+			return nil, nil, fmt.Errorf("could not create HTTP client for Orchestrator: %v", err)
+		}
+		httpClients = append(httpClients, httpClient)
+		collectors[service] = func(ctx context.Context) (collector.Collector, error) {
+			orchestratorClient, err := client.NewOrchestratorClient(ctx, httpClient, cfg.Orchestrator.URI,
+				cfg.Orchestrator.Endpoints, cfg.Orchestrator.DiscoverNodes)
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewOrchestratorCollector(orchestratorClient, service), nil
 		}
-		registry.MustRegister(collector.NewOrchestratorCollector(orchestatorClient.(*client.OrchestratorClient), service))
 	}
 
-	if *xtradbCluster {
+	// DSNs are built before clients are created, so errors of configuration keep the current registry on reload
+	if cfg.XtradbCluster.Enabled {
 		service := "xtradb_cluster"
-		xtradbClient, err := client.CreateClientWithRetries(service, func() (interface{}, error) {
-			return client.NewXtradbClient(*xtradbClusterMycnf, *sslVerify)
-		}, *retries, *retryInterval)
+		dsn, err := client.XtradbDSN(cfg.XtradbCluster)
 		if err != nil {
-			log.Fatalf("Could not create Xtradb cluster Client: %v", err)
+			return nil, nil, fmt.Errorf("could not configure Xtradb cluster client: %v", err)
+		}
+		collectors[service] = func(ctx context.Context) (collector.Collector, error) {
+			xtradbClient, err := client.NewXtradbClient(ctx, dsn, cfg.XtradbCluster)
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewXtradbCollector(xtradbClient, service), nil
 		}
-		registry.MustRegister(collector.NewXtradbCollector(xtradbClient.(*client.XtradbClient), service))
 	}
 
-	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte(`<html>
-			<head><title>Orcus Exporter</title></head>
-			<body>
-			<h1>Orcus Exporter</h1>
-			<p><a href='/metrics'>Metrics</a></p>
-			</body>
-			</html>`))
+	if cfg.OrchestratorBackend.Enabled {
+		service := "orchestrator_backend"
+		dsn, err := client.OrchestratorBackendDSN(cfg.OrchestratorBackend)
 		if err != nil {
-			log.Printf("Error while sending a response for the '/' path: %v", err)
+			return nil, nil, fmt.Errorf("could not configure Orchestrator backend client: %v", err)
 		}
-	})
-	log.Printf("Orcus Prometheus Exporter has successfully started")
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+		collectors[service] = func(ctx context.Context) (collector.Collector, error) {
+			backendClient, err := client.NewOrchestratorBackendClient(ctx, dsn, cfg.OrchestratorBackend)
+			if err != nil {
+				return nil, err
+			}
+			return collector.NewOrchestratorBackendCollector(backendClient, service), nil
+		}
+	}
+
+	timeouts := map[string]time.Duration{
+		"nginx":                cfg.Nginx.Timeout,
+		"oauth2_proxy":         cfg.Oauth2Proxy.Timeout,
+		"orcus":                cfg.Orcus.Timeout,
+		"orchestrator":         cfg.Orchestrator.Timeout,
+		"xtradb_cluster":       cfg.XtradbCluster.Timeout,
+		"orchestrator_backend": cfg.OrchestratorBackend.Timeout,
+	}
+
+	// Collectors are registered even if their services are unavailable on start,
+	// clients for such services are created on subsequent scrapes.
+	scrapeCollector := collector.NewScrapeCollector("orcusexporter")
+	for service, newCollector := range collectors {
+		lazyCollector := collector.NewLazyCollector(newCollector, service, cfg.RetryInterval)
+		scrapeCollector.Add(service, lazyCollector, timeouts[service])
+		// The first attempt runs in background, so unavailable services delay neither start nor reload
+		go func(service string, lazyCollector *collector.LazyCollector, timeout time.Duration) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := lazyCollector.Connect(ctx); err != nil {
+				log.Printf("Could not create %s Client, will retry on scrape: %v", service, err)
+			}
+		}(service, lazyCollector, timeouts[service])
+	}
+	closer := &registryCloser{scrapeCollector: scrapeCollector, httpClients: httpClients}
+	if err := registry.Register(scrapeCollector); err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+
+	return registry, closer, nil
+}
+
+// registryCloser releases resources held by collectors and HTTP clients of a registry.
+type registryCloser struct {
+	scrapeCollector *collector.ScrapeCollector
+	httpClients     []*http.Client
+}
+
+// Close closes collectors and idle connections of HTTP clients.
+func (c *registryCloser) Close() error {
+	err := c.scrapeCollector.Close()
+	for _, httpClient := range c.httpClients {
+		httpClient.CloseIdleConnections()
+	}
+	return err
+}
+
+// loadConfig builds exporter configuration from flags and configuration file.
+// Flags set explicitly on the command line take precedence over the file, global
+// timeout and ssl-verify flags take precedence only over global settings of the file.
+func loadConfig() (*config.Config, error) {
+	cfg := &config.Config{
+		// Defaults of settings which can be changed only in configuration file
+		XtradbCluster: config.XtradbCollector{
+			MaxOpenConns:    1,
+			MaxIdleConns:    1,
+			ConnMaxLifetime: time.Minute,
+		},
+		OrchestratorBackend: config.OrchestratorBackendCollector{
+			Database:     "orchestrator",
+			PollInterval: 5 * time.Second,
+		},
+	}
+	overrides := map[string]func(){
+		"config.retry-interval": func() { cfg.RetryInterval = *retryInterval },
+		"config.timeout": func() {
+			cfg.Timeout = *timeout
+			for _, m := range cfg.Modules {
+				m.Timeout = *timeout
+			}
+			cfg.Nginx.Timeout = *timeout
+			cfg.Oauth2Proxy.Timeout = *timeout
+			cfg.Orcus.Timeout = *timeout
+			cfg.Orchestrator.Timeout = *timeout
+			cfg.XtradbCluster.Timeout = *timeout
+			cfg.OrchestratorBackend.Timeout = *timeout
+		},
+		"config.ssl-verify": func() {
+			cfg.SSLVerify = *sslVerify
+			for _, m := range cfg.Modules {
+				m.TLS.SSLVerify = *sslVerify
+			}
+			cfg.Nginx.TLS.SSLVerify = *sslVerify
+			cfg.Oauth2Proxy.TLS.SSLVerify = *sslVerify
+			cfg.Orcus.TLS.SSLVerify = *sslVerify
+			cfg.Orchestrator.TLS.SSLVerify = *sslVerify
+			cfg.XtradbCluster.TLS.SSLVerify = *sslVerify
+			cfg.OrchestratorBackend.TLS.SSLVerify = *sslVerify
+		},
+		"collector.nginx":                 func() { cfg.Nginx.Enabled = *nginx },
+		"collector.nginx.uri":             func() { cfg.Nginx.URI = *nginxURI },
+		"collector.oauth2_proxy":          func() { cfg.Oauth2Proxy.Enabled = *oauth2Proxy },
+		"collector.oauth2_proxy.uri":      func() { cfg.Oauth2Proxy.URI = *oauth2ProxyURI },
+		"collector.orcus":                 func() { cfg.Orcus.Enabled = *orcus },
+		"collector.orcus.uri":             func() { cfg.Orcus.URI = *orcusURI },
+		"collector.orchestrator":          func() { cfg.Orchestrator.Enabled = *orchestrator },
+		"collector.orchestrator.uri":      func() { cfg.Orchestrator.URI = *orchestratorURI },
+		"collector.xtradb-cluster":        func() { cfg.XtradbCluster.Enabled = *xtradbCluster },
+		"collector.xtradb-cluster.my-cnf": func() { cfg.XtradbCluster.MyCnf = *xtradbClusterMycnf },
+
+		"collector.orchestrator.endpoints":        func() { cfg.Orchestrator.Endpoints = splitList(*orchestratorNodes) },
+		"collector.orchestrator.discover-nodes":   func() { cfg.Orchestrator.DiscoverNodes = *discoverNodes },
+		"collector.xtradb-cluster.nodes":          func() { cfg.XtradbCluster.Nodes = splitList(*xtradbClusterNodes) },
+		"collector.xtradb-cluster.discover-nodes": func() { cfg.XtradbCluster.DiscoverNodes = *xtradbDiscovery },
+		"collector.xtradb-cluster.server":         func() { cfg.XtradbCluster.Server = *xtradbServer },
+		"collector.orchestrator-backend":          func() { cfg.OrchestratorBackend.Enabled = *orchestratorBackend },
+		"collector.orchestrator-backend.my-cnf":   func() { cfg.OrchestratorBackend.MyCnf = *orchestratorBackendMycnf },
+
+		"collector.xtradb-cluster.my-cnf-section": func() { cfg.XtradbCluster.MyCnfSection = *xtradbClusterMycnfSection },
+		"collector.xtradb-cluster.login-path":     func() { cfg.XtradbCluster.LoginPath = *xtradbClusterLoginPath },
+
+		"collector.xtradb-cluster.host":          func() { cfg.XtradbCluster.Host = *xtradbClusterHost },
+		"collector.xtradb-cluster.port":          func() { cfg.XtradbCluster.Port = *xtradbClusterPort },
+		"collector.xtradb-cluster.user-file":     func() { cfg.XtradbCluster.UserFile = *xtradbClusterUserFile },
+		"collector.xtradb-cluster.password-file": func() { cfg.XtradbCluster.PasswordFile = *xtradbClusterPasswordFile },
+		"collector.xtradb-cluster.tls.ca-file":   func() { cfg.XtradbCluster.TLS.CAFile = *xtradbClusterCAFile },
+		"collector.xtradb-cluster.tls.cert-file": func() { cfg.XtradbCluster.TLS.CertFile = *xtradbClusterCertFile },
+		"collector.xtradb-cluster.tls.key-file":  func() { cfg.XtradbCluster.TLS.KeyFile = *xtradbClusterKeyFile },
+	}
+	for _, override := range overrides {
+		override()
+	}
+
+	if *configFile != "" {
+		// Global timeout and ssl-verify flags are defaults for sections of the file without their own values
+		var defaults config.Defaults
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "config.timeout":
+				defaults.Timeout = timeout
+			case "config.ssl-verify":
+				defaults.SSLVerify = sslVerify
+			}
+		})
+		if err := config.LoadFile(*configFile, cfg, defaults); err != nil {
+			return nil, err
+		}
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "config.timeout" || f.Name == "config.ssl-verify" {
+				return
+			}
+			if override, ok := overrides[f.Name]; ok {
+				override()
+			}
+		})
+	}
+
+	// DSN is read only from environment to keep the password out of command line and configuration file
+	cfg.XtradbCluster.DSN = os.Getenv("DATA_SOURCE_NAME")
+
+	return cfg, cfg.Validate()
+}
+
+// splitList splits comma separated list and drops empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func newHTTPClient(cfg config.HTTPCollector) (*http.Client, error) {
+	tlsConfig, err := config.NewTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: client.NewAuthRoundTripper(cfg.Auth, &http.Transport{
+			TLSClientConfig: tlsConfig,
+		}),
+	}, nil
 }
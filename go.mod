@@ -16,4 +16,5 @@ require (
 	golang.org/x/sys v0.0.0-20190913121621-c3b328c6e5a7 // indirect
 	google.golang.org/appengine v1.6.2 // indirect
 	gopkg.in/ini.v1 v1.46.0
+	gopkg.in/yaml.v2 v2.2.2
 )